@@ -1,8 +1,151 @@
 package main
 
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/chzyer/readline"
+	"github.com/codecrafters-io/shell-starter-go/shell"
+)
+
+const usage = "usage: %s [-ilns] [--norc] [--rcfile file] [--posix] [-c command_string [name [arg ...]] | file [arg ...]]\n"
+
+// flags are the options on the command line.
+type flags struct {
+	// command runs the first argument as a command string, stdin reads
+	// the commands from the standard input even with arguments.
+	command     bool
+	stdin       bool
+	interactive bool
+	login       bool
+	norc        bool
+	rcfile      string
+	posix       bool
+	noexec      bool
+}
+
+// parseArgs splits the command line into the options and the remaining
+// arguments.
+func parseArgs(args []string) (flags, []string, error) {
+	var f flags
+	for len(args) > 0 {
+		arg := args[0]
+		switch {
+		case arg == "--":
+			return f, args[1:], nil
+		case arg == "--norc":
+			f.norc = true
+		case arg == "--login":
+			f.login = true
+		case arg == "--rcfile":
+			if len(args) < 2 {
+				return f, nil, errors.New("--rcfile: option requires an argument")
+			}
+			f.rcfile = args[1]
+			args = args[1:]
+		case arg == "--posix":
+			f.posix = true
+		case strings.HasPrefix(arg, "--"):
+			return f, nil, fmt.Errorf("%s: invalid option", arg)
+		case len(arg) < 2 || arg[0] != '-':
+			return f, args, nil
+		default:
+			for _, c := range arg[1:] {
+				switch c {
+				case 'c':
+					f.command = true
+				case 's':
+					f.stdin = true
+				case 'i':
+					f.interactive = true
+				case 'l':
+					f.login = true
+				case 'n':
+					f.noexec = true
+				default:
+					return f, nil, fmt.Errorf("-%c: invalid option", c)
+				}
+			}
+		}
+		args = args[1:]
+	}
+	return f, args, nil
+}
+
 func main() {
 
-	sh := NewShell()
+	name := os.Args[0]
+	f, args, err := parseArgs(os.Args[1:])
+	if err == nil && f.command && len(args) == 0 {
+		err = errors.New("-c: option requires an argument")
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+		fmt.Fprintf(os.Stderr, usage, filepath.Base(name))
+		os.Exit(2)
+	}
+
+	cfg := shell.Config{
+		Name: name,
+		Args: args,
+		// login(1) starts a login shell with a dash before its name
+		Login:  f.login || strings.HasPrefix(filepath.Base(name), "-"),
+		RCFile: f.rcfile,
+		NoRC:   f.norc,
+	}
+	cfg.Options.Set(shell.OptNoexec, f.noexec)
+	cfg.Options.Set(shell.OptPosix, f.posix)
+	ctx := context.Background()
+
+	var (
+		sh *shell.Shell
+		// run is not set for an interactive shell
+		run func() (int, error)
+	)
+	switch {
+	case f.command:
+		// `-c string [name [arg ...]]`
+		src := args[0]
+		if len(args) > 1 {
+			cfg.Name, cfg.Args = args[1], args[2:]
+		} else {
+			cfg.Args = nil
+		}
+		sh = shell.New(cfg)
+		run = func() (int, error) { return sh.RunReader(ctx, strings.NewReader(src)) }
+	case !f.stdin && len(args) > 0:
+		// `file [arg ...]`, which is also how a #! line runs it
+		cfg.Name, cfg.Args = args[0], args[1:]
+		sh = shell.New(cfg)
+		run = func() (int, error) { return sh.RunFile(ctx, args[0]) }
+	default:
+		sh = shell.New(cfg)
+		if !f.interactive && !readline.IsTerminal(int(os.Stdin.Fd())) {
+			run = func() (int, error) { return sh.RunReader(ctx, os.Stdin) }
+		}
+	}
 
-	sh.Run()
+	if err := sh.RunStartup(ctx, run == nil); err != nil {
+		os.Exit(sh.Exit())
+	}
+	if run == nil {
+		sh.Run()
+		os.Exit(sh.Exit())
+	}
+	status, err := run()
+	var pathErr *fs.PathError
+	switch {
+	case errors.As(err, &pathErr):
+		fmt.Fprintf(os.Stderr, "%s: %s: %v\n", name, pathErr.Path, pathErr.Err)
+		os.Exit(status)
+	case err != nil && !errors.Is(err, shell.ErrExit):
+		// syntax errors tell where they are
+		fmt.Fprintln(os.Stderr, err)
+	}
+	os.Exit(sh.Exit())
 }
@@ -4,6 +4,7 @@ import (
 	"log"
 	"os"
 	"os/exec"
+	"reflect"
 	"testing"
 )
 
@@ -52,3 +53,27 @@ func TestPipe(t *testing.T) {
 		log.Printf("cmd2执行失败: %v", err)
 	}
 }
+
+func TestParseArgs(t *testing.T) {
+	f, args, err := parseArgs([]string{"-nc", "echo $1", "name", "-x"})
+	if err != nil || !f.command || !f.noexec || !reflect.DeepEqual(args, []string{"echo $1", "name", "-x"}) {
+		t.Errorf("got %+v %q %v", f, args, err)
+	}
+
+	f, args, err = parseArgs([]string{"--norc", "-il", "--", "-s"})
+	if err != nil || !f.norc || !f.interactive || !f.login || f.stdin || !reflect.DeepEqual(args, []string{"-s"}) {
+		t.Errorf("got %+v %q %v", f, args, err)
+	}
+
+	f, args, err = parseArgs([]string{"--rcfile", "rc", "--posix", "script"})
+	if err != nil || f.rcfile != "rc" || !f.posix || !reflect.DeepEqual(args, []string{"script"}) {
+		t.Errorf("got %+v %q %v", f, args, err)
+	}
+
+	if _, _, err := parseArgs([]string{"-z"}); err == nil {
+		t.Error("-z: want an error")
+	}
+	if _, _, err := parseArgs([]string{"--rcfile"}); err == nil {
+		t.Error("--rcfile: want an error")
+	}
+}
@@ -0,0 +1,296 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// HasMeta reports whether pattern holds an unescaped glob metacharacter.
+func HasMeta(pattern string) bool {
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '*', '?', '[':
+			return true
+		}
+	}
+	return false
+}
+
+// QuoteMeta escapes every glob metacharacter in s so that it only matches
+// itself.
+func QuoteMeta(s string) string {
+	var sb strings.Builder
+	for _, c := range s {
+		switch c {
+		case '*', '?', '[', ']', '\\':
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(c)
+	}
+	return sb.String()
+}
+
+// Unescape drops the backslashes of an escaped pattern.
+func Unescape(pattern string) string {
+	if !strings.Contains(pattern, `\`) {
+		return pattern
+	}
+	var sb strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] == '\\' && i+1 < len(pattern) {
+			i++
+		}
+		sb.WriteByte(pattern[i])
+	}
+	return sb.String()
+}
+
+// Match reports whether s matches the shell pattern. It supports `*`, `?`,
+// bracket expressions with ranges, negation and character classes, and
+// backslash escapes. fold makes the match case-insensitive.
+func Match(pattern, s string, fold bool) bool {
+	return match([]rune(pattern), []rune(s), fold)
+}
+
+func match(p, s []rune, fold bool) bool {
+	for len(p) > 0 {
+		switch p[0] {
+		case '*':
+			for len(p) > 0 && p[0] == '*' {
+				p = p[1:]
+			}
+			if len(p) == 0 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if match(p, s[i:], fold) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+			p, s = p[1:], s[1:]
+		case '[':
+			if len(s) == 0 {
+				return false
+			}
+			ok, n := matchBracket(p, s[0], fold)
+			if n == 0 {
+				// no closing bracket, '[' is literal
+				if !equalRune('[', s[0], fold) {
+					return false
+				}
+				p, s = p[1:], s[1:]
+				continue
+			}
+			if !ok {
+				return false
+			}
+			p, s = p[n:], s[1:]
+		case '\\':
+			if len(p) > 1 {
+				p = p[1:]
+			}
+			fallthrough
+		default:
+			if len(s) == 0 || !equalRune(p[0], s[0], fold) {
+				return false
+			}
+			p, s = p[1:], s[1:]
+		}
+	}
+	return len(s) == 0
+}
+
+// matchBracket matches c against the bracket expression at the start of p.
+// It returns the length of the expression, or 0 if it is not terminated.
+func matchBracket(p []rune, c rune, fold bool) (bool, int) {
+	i := 1
+	negate := false
+	if i < len(p) && (p[i] == '!' || p[i] == '^') {
+		negate = true
+		i++
+	}
+
+	matched := false
+	first := true
+	for i < len(p) {
+		if p[i] == ']' && !first {
+			return matched != negate, i + 1
+		}
+		first = false
+
+		if p[i] == '[' && i+1 < len(p) && p[i+1] == ':' {
+			end := indexRunes(p[i+2:], ":]")
+			if end >= 0 {
+				class := string(p[i+2 : i+2+end])
+				if matchClass(class, c) {
+					matched = true
+				}
+				i += end + 4
+				continue
+			}
+		}
+
+		lo := p[i]
+		if lo == '\\' && i+1 < len(p) {
+			i++
+			lo = p[i]
+		}
+		i++
+
+		hi := lo
+		if i+1 < len(p) && p[i] == '-' && p[i+1] != ']' {
+			hi = p[i+1]
+			if hi == '\\' && i+2 < len(p) {
+				hi = p[i+2]
+				i++
+			}
+			i += 2
+		}
+
+		if inRange(lo, hi, c) || (fold && (inRange(lo, hi, unicode.ToLower(c)) || inRange(lo, hi, unicode.ToUpper(c)))) {
+			matched = true
+		}
+	}
+	return false, 0
+}
+
+func inRange(lo, hi, c rune) bool {
+	return lo <= c && c <= hi
+}
+
+func indexRunes(p []rune, sub string) int {
+	s := []rune(sub)
+	for i := 0; i+len(s) <= len(p); i++ {
+		if string(p[i:i+len(s)]) == sub {
+			return i
+		}
+	}
+	return -1
+}
+
+func matchClass(class string, c rune) bool {
+	switch class {
+	case "alnum":
+		return unicode.IsLetter(c) || unicode.IsDigit(c)
+	case "alpha":
+		return unicode.IsLetter(c)
+	case "blank":
+		return c == ' ' || c == '\t'
+	case "cntrl":
+		return unicode.IsControl(c)
+	case "digit":
+		return '0' <= c && c <= '9'
+	case "graph":
+		return unicode.IsGraphic(c) && !unicode.IsSpace(c)
+	case "lower":
+		return unicode.IsLower(c)
+	case "print":
+		return unicode.IsPrint(c)
+	case "punct":
+		return unicode.IsPunct(c) || unicode.IsSymbol(c)
+	case "space":
+		return unicode.IsSpace(c)
+	case "upper":
+		return unicode.IsUpper(c)
+	case "xdigit":
+		return strings.ContainsRune("0123456789abcdefABCDEF", c)
+	}
+	return false
+}
+
+func equalRune(a, b rune, fold bool) bool {
+	if a == b {
+		return true
+	}
+	return fold && unicode.ToLower(a) == unicode.ToLower(b)
+}
+
+// Glob returns the sorted pathnames matching pattern, resolving relative
+// patterns against dir. Hidden entries only match a component that starts
+// with a literal dot.
+func Glob(dir, pattern string) []string {
+	if pattern == "" {
+		return nil
+	}
+
+	var prefixes []string
+	if strings.HasPrefix(pattern, "/") {
+		prefixes = []string{"/"}
+		pattern = strings.TrimLeft(pattern, "/")
+	} else {
+		prefixes = []string{""}
+	}
+
+	components := strings.Split(pattern, "/")
+	for idx, comp := range components {
+		last := idx == len(components)-1
+		var next []string
+		for _, prefix := range prefixes {
+			if comp == "" {
+				// repeated or trailing slash
+				next = append(next, prefix)
+				continue
+			}
+			if !HasMeta(comp) {
+				next = append(next, joinPath(prefix, Unescape(comp)))
+				continue
+			}
+			entries, err := os.ReadDir(resolve(dir, prefix))
+			if err != nil {
+				continue
+			}
+			for _, e := range entries {
+				name := e.Name()
+				if strings.HasPrefix(name, ".") && !strings.HasPrefix(comp, ".") {
+					continue
+				}
+				if !last && !e.IsDir() && e.Type()&os.ModeSymlink == 0 {
+					continue
+				}
+				if Match(comp, name, false) {
+					next = append(next, joinPath(prefix, name))
+				}
+			}
+		}
+		prefixes = next
+	}
+
+	var res []string
+	for _, p := range prefixes {
+		if _, err := os.Lstat(resolve(dir, p)); err == nil {
+			res = append(res, p)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+func joinPath(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	if strings.HasSuffix(prefix, "/") {
+		return prefix + name
+	}
+	return prefix + "/" + name
+}
+
+func resolve(dir, p string) string {
+	if p == "" {
+		p = "."
+	}
+	if filepath.IsAbs(p) || dir == "" {
+		return p
+	}
+	return filepath.Join(dir, p)
+}
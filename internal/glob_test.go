@@ -0,0 +1,34 @@
+package internal
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+	cases := []struct {
+		pattern string
+		s       string
+		fold    bool
+		want    bool
+	}{
+		{"*", "", false, true},
+		{"start", "start", false, true},
+		{"st*", "stop", false, true},
+		{"st?p", "stop", false, true},
+		{"st?p", "stp", false, false},
+		{"[a-c]x", "bx", false, true},
+		{"[!a-c]x", "bx", false, false},
+		{"[^a-c]x", "dx", false, true},
+		{"[[:digit:]]*", "1abc", false, true},
+		{"[]]", "]", false, true},
+		{`\*`, "*", false, true},
+		{`\*`, "a", false, false},
+		{"[abc", "[abc", false, true},
+		{"START", "start", false, false},
+		{"START", "start", true, true},
+		{"[A-C]*", "beta", true, true},
+	}
+	for _, c := range cases {
+		if got := Match(c.pattern, c.s, c.fold); got != c.want {
+			t.Errorf("Match(%q, %q, %v) = %v, want %v", c.pattern, c.s, c.fold, got, c.want)
+		}
+	}
+}
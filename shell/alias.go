@@ -0,0 +1,118 @@
+package shell
+
+import (
+	"fmt"
+	"strings"
+)
+
+// validAliasName reports whether name can be defined as an alias, it must
+// be a plain word that the scanner reads back unchanged.
+func validAliasName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if isMetaChar(r) || strings.ContainsRune("/$`='\"\\", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// printAlias writes the definition of name in a form the shell reads back.
+func (c *Command) printAlias(name string) {
+	fmt.Fprintf(c.stdio.Out, "alias %s=%s\n", name, shellQuote(c.sh.aliases[name]))
+}
+
+func (c *Command) execAlias() error {
+	args := c.Args[1:]
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+		arg := args[0]
+		args = args[1:]
+		if arg == "--" {
+			break
+		}
+		for _, f := range arg[1:] {
+			if f != 'p' {
+				fmt.Fprintf(c.stdio.Err, "alias: -%c: invalid option\n", f)
+				fmt.Fprintln(c.stdio.Err, "alias: usage: alias [-p] [name[=value] ... ]")
+				return statusError(2)
+			}
+		}
+	}
+
+	if len(args) == 0 {
+		for _, name := range sortedKeys(c.sh.aliases) {
+			c.printAlias(name)
+		}
+		return nil
+	}
+
+	status := 0
+	for _, arg := range args {
+		name, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			if _, found := c.sh.aliases[name]; !found {
+				fmt.Fprintf(c.stdio.Err, "alias: %s: not found\n", name)
+				status = 1
+				continue
+			}
+			c.printAlias(name)
+			continue
+		}
+		if !validAliasName(name) {
+			fmt.Fprintf(c.stdio.Err, "alias: `%s': invalid alias name\n", name)
+			status = 1
+			continue
+		}
+		c.sh.aliases[name] = value
+	}
+	if status != 0 {
+		return statusError(status)
+	}
+	return nil
+}
+
+func (c *Command) execUnalias() error {
+	args := c.Args[1:]
+	all := false
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+		arg := args[0]
+		args = args[1:]
+		if arg == "--" {
+			break
+		}
+		for _, f := range arg[1:] {
+			if f != 'a' {
+				fmt.Fprintf(c.stdio.Err, "unalias: -%c: invalid option\n", f)
+				fmt.Fprintln(c.stdio.Err, "unalias: usage: unalias [-a] name [name ...]")
+				return statusError(2)
+			}
+			all = true
+		}
+	}
+
+	if all {
+		// the map is shared with the completer, it is emptied in place
+		clear(c.sh.aliases)
+		return nil
+	}
+	if len(args) == 0 {
+		fmt.Fprintln(c.stdio.Err, "unalias: usage: unalias [-a] name [name ...]")
+		return statusError(2)
+	}
+
+	status := 0
+	for _, name := range args {
+		if _, ok := c.sh.aliases[name]; !ok {
+			fmt.Fprintf(c.stdio.Err, "unalias: %s: not found\n", name)
+			status = 1
+			continue
+		}
+		delete(c.sh.aliases, name)
+	}
+	if status != 0 {
+		return statusError(status)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package shell
+
+// Node is a piece of a parsed command line. *Command is the simple command,
+// the other node types group commands together.
+type Node interface {
+	node()
+}
+
+// List is a sequence of and-or lists separated by `;` or newlines.
+type List struct {
+	Items []*AndOr
+}
+
+// AndOr is a chain of pipelines joined by `&&` or `||`, Ops[i] sits between
+// Pipelines[i] and Pipelines[i+1]. Async is set when it ends with `&`.
+type AndOr struct {
+	Pipelines []*Pipeline
+	Ops       []TokenType
+	Async     bool
+}
+
+type Pipeline struct {
+	Cmds   []Node
+	Negate bool
+}
+
+type CaseItem struct {
+	Patterns []Token
+	Body     *List
+	// Term is TokenDSemi, TokenSemiAnd or TokenDSemiAnd.
+	Term TokenType
+}
+
+type CaseClause struct {
+	Word  Token
+	Items []*CaseItem
+}
+
+// FuncDef defines a shell function, running it only records the body.
+// Body is a brace group or a subshell.
+type FuncDef struct {
+	Name string
+	Body Node
+}
+
+// Subshell is `( list )`, run on a copy of the shell state.
+type Subshell struct {
+	Body *List
+	Redirects
+}
+
+// BraceGroup is `{ list; }`, run in the current shell.
+type BraceGroup struct {
+	Body *List
+	Redirects
+}
+
+// CondCommand is `[[ expression ]]`.
+type CondCommand struct {
+	Expr *CondExpr
+}
+
+// CondExpr is a node of a [[ ]] expression. Op is "&&", "||", "!" or "("
+// for the connectives, a unary or binary operator such as "-f" or "==", or
+// empty for a lone word that is true when non-empty.
+type CondExpr struct {
+	Op    string
+	X, Y  *CondExpr
+	Words []Token
+}
+
+func (*List) node()        {}
+func (*AndOr) node()       {}
+func (*Pipeline) node()    {}
+func (*Command) node()     {}
+func (*CaseClause) node()  {}
+func (*FuncDef) node()     {}
+func (*Subshell) node()    {}
+func (*BraceGroup) node()  {}
+func (*CondCommand) node() {}
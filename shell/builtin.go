@@ -0,0 +1,246 @@
+package shell
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Builtin is a command the shell runs itself instead of starting a
+// program. Builtins run with the shell's context and read their arguments
+// from c.Args and their redirected input and output from c.Stdio().
+type Builtin interface {
+	Name() string
+	Run(ctx context.Context, c *Command) error
+	// Help returns the usage line, followed by a description on the next
+	// lines.
+	Help() string
+	// Complete returns the candidates for the last of args, the words typed
+	// after the builtin's name, or nil if it has none.
+	Complete(args []string) []string
+}
+
+// Registry holds the builtins a shell knows by name. Register is not safe
+// to call while the shell runs commands.
+type Registry struct {
+	builtins map[string]Builtin
+}
+
+func NewRegistry() *Registry {
+	return &Registry{builtins: make(map[string]Builtin)}
+}
+
+// DefaultRegistry returns a registry holding the standard builtins.
+func DefaultRegistry() *Registry {
+	r := NewRegistry()
+	for _, b := range standardBuiltins {
+		r.Register(b)
+	}
+	return r
+}
+
+// Register adds b, replacing any builtin of the same name.
+func (r *Registry) Register(b Builtin) {
+	r.builtins[b.Name()] = b
+}
+
+func (r *Registry) Unregister(name string) {
+	delete(r.builtins, name)
+}
+
+func (r *Registry) Lookup(name string) (Builtin, bool) {
+	b, ok := r.builtins[name]
+	return b, ok
+}
+
+// Names returns the names of the builtins in sorted order.
+func (r *Registry) Names() []string {
+	return sortedKeys(r.builtins)
+}
+
+// BuiltinFunc is a Builtin made of a function, for builtins that need no
+// completion.
+type BuiltinFunc struct {
+	BuiltinName string
+	Usage       string
+	Fn          func(ctx context.Context, c *Command) error
+}
+
+func (b *BuiltinFunc) Name() string { return b.BuiltinName }
+
+func (b *BuiltinFunc) Run(ctx context.Context, c *Command) error { return b.Fn(ctx, c) }
+
+func (b *BuiltinFunc) Help() string { return b.Usage }
+
+func (b *BuiltinFunc) Complete(args []string) []string { return nil }
+
+// builtin is a standard builtin implemented by a Command method.
+type builtin struct {
+	name     string
+	help     string
+	run      func(c *Command) error
+	complete func(args []string) []string
+	// completeVars is complete for the builtins whose candidates depend on
+	// the shell's variables, it is only used by the shell's completer.
+	completeVars func(getVar func(string) (string, bool), args []string) []string
+}
+
+// varCompleter is a Builtin that completes from the shell's variables.
+type varCompleter interface {
+	completeWith(getVar func(string) (string, bool), args []string) []string
+}
+
+func (b *builtin) Name() string { return b.name }
+
+func (b *builtin) Run(ctx context.Context, c *Command) error { return b.run(c) }
+
+func (b *builtin) Help() string { return b.help }
+
+func (b *builtin) Complete(args []string) []string {
+	if b.complete == nil {
+		return nil
+	}
+	return b.complete(args)
+}
+
+func (b *builtin) completeWith(getVar func(string) (string, bool), args []string) []string {
+	if b.completeVars == nil {
+		return b.Complete(args)
+	}
+	return b.completeVars(getVar, args)
+}
+
+var standardBuiltins = []*builtin{
+	{name: "pwd", help: "pwd [-LP]\nPrint the current working directory, with -P without symlinks.", run: (*Command).execPwd},
+	{name: "cd", help: "cd [-L|-P] [dir]\nChange the current directory to dir, HOME by default. `cd -` goes back to\nOLDPWD, a relative dir is searched in CDPATH. -P resolves symlinks.", run: (*Command).execCd},
+	{name: "exit", help: "exit [n]\nExit the shell with status n, or the status of the last command.", run: (*Command).execExit},
+	{name: "echo", help: "echo [-neE] [arg ...]\nWrite the arguments separated by spaces, followed by a newline unless -n is\ngiven. -e interprets backslash escapes, -E does not.", run: (*Command).execEcho},
+	{name: "printf", help: "printf [-v var] format [arguments]\nWrite the arguments under the control of format, reusing it while arguments\nremain. Besides those of printf(3) it knows %b, %q and %(fmt)T. -v assigns\nthe output to var.", run: (*Command).execPrintf},
+	{name: "type", help: "type [-afptP] name [name ...]\nTell how each name would be run as a command. -a lists every match, -t\nprints a single word, -p the file that would run, -P searches PATH even\nfor builtins. -f skips functions.", run: (*Command).execType},
+	{name: "alias", help: "alias [-p] [name[=value] ... ]\nDefine or print aliases. An alias replaces the first word of a simple command\nwith its value, if the value ends with a blank the next word is expanded\ntoo.", run: (*Command).execAlias},
+	{name: "unalias", help: "unalias [-a] name [name ...]\nRemove the named aliases, or all of them with -a.", run: (*Command).execUnalias},
+	{name: "command", help: "command [-pVv] command [arg ...]\nRun command skipping functions, with -p in a default PATH. -v prints how\ncommand would run, -V describes it like type.", run: (*Command).execCommand},
+	{name: "builtin", help: "builtin shell-builtin [arg ...]\nRun a shell builtin, even when a function has its name.", run: (*Command).execBuiltin},
+	{name: "hash", help: "hash [-lr] [-p pathname] [-dt] [name ...]\nRemember where the named programs are found, or list the remembered ones\nwith the number of times they ran. -r forgets all, -d the names, -p gives\nthe path, -t prints it, -l lists in a reusable form.", run: (*Command).execHash},
+	{name: "history", help: "history [n] | history -r|-w|-a file\nList the history, or read, write or append it to file.", run: (*Command).execHistory},
+	{name: "shopt", help: "shopt [-su] [-oq] [optname ...]\nSet, unset or list the shell options.", run: (*Command).execShopt, complete: completeShopt},
+	{name: "local", help: "local name[=value] ...\nCreate variables visible only in the current function.", run: (*Command).execLocal},
+	{name: "return", help: "return [n]\nReturn from a function with status n.", run: (*Command).execReturn},
+	{name: "test", help: "test [expr]\nEvaluate a conditional expression.", run: (*Command).execTest},
+	{name: "[", help: "[ arg ... ]\nEvaluate a conditional expression, like test with a closing ].", run: (*Command).execTest},
+	{name: "jobs", help: "jobs [-lp] [job ...]\nList the jobs and their status.", run: (*Command).execJobs},
+	{name: "fg", help: "fg [job]\nMove a job to the foreground.", run: (*Command).execFg},
+	{name: "bg", help: "bg [job ...]\nResume stopped jobs in the background.", run: (*Command).execBg},
+	{name: "wait", help: "wait [id ...]\nWait for jobs or processes and return the exit status of the last.", run: (*Command).execWait},
+	{name: "trap", help: "trap [-lp] [[arg] signal_spec ...]\nRun arg when the shell receives a signal or meets a condition.", run: (*Command).execTrap, complete: completeTrap},
+	{name: "set", help: "set [-efnuxC] [-o option-name] [--] [arg ...]\nSet or unset options and positional parameters.", run: (*Command).execSet, complete: completeSet},
+	{name: "dirs", help: "dirs [-clpv] [+N] [-N]\nList the directory stack, -c clears it. -l does not abbreviate HOME as ~,\n-p prints one entry per line, -v numbers them.", run: (*Command).execDirs},
+	{name: "pushd", help: "pushd [-n] [dir | +N | -N]\nChange to dir and push it on the directory stack, or rotate the Nth entry\nto the top. With no argument the top two entries are swapped. -n adds dir\nwithout changing to it.", run: (*Command).execPushd},
+	{name: "popd", help: "popd [-n] [+N | -N]\nRemove the top of the directory stack and change to the new top, or\nremove the Nth entry. -n removes the entry below the top instead.", run: (*Command).execPopd},
+	{name: "z", help: "z [-l] [pattern ...]\nChange to the most frecent directory matching the patterns, or list the\nmatches with -l. cd records its directories in $_Z_DATA, or ~/.z.", run: (*Command).execZ, completeVars: completeZ},
+	{name: "read", help: "read [-rs] [-a array] [-d delim] [-n nchars] [-p prompt] [-t timeout] [name ...]\nRead a line and split it on IFS into the names, the last one taking the\nrest, or into REPLY. -r keeps backslashes, -s does not echo, -a fills an\narray, -d ends at delim, -n after nchars characters, -t gives up after\ntimeout seconds.", run: (*Command).execRead},
+	{name: "source", help: "source filename [arguments]\nRun the commands of filename in the current shell, with the arguments as\npositional parameters. A filename without a slash is searched in PATH.", run: (*Command).execSource},
+	{name: ".", help: ". filename [arguments]\nRun the commands of filename in the current shell, like source.", run: (*Command).execSource},
+	{name: "help", help: "help [pattern ...]\nDisplay information about builtin commands.", run: (*Command).execHelp},
+}
+
+func (c *Command) execHelp() error {
+	reg := c.sh.builtins
+	args := c.Args[1:]
+	if len(args) == 0 {
+		for _, name := range reg.Names() {
+			b, _ := reg.Lookup(name)
+			usage, _, _ := strings.Cut(b.Help(), "\n")
+			fmt.Fprintln(c.stdio.Out, usage)
+		}
+		return nil
+	}
+
+	status := 0
+	for _, pattern := range args {
+		found := false
+		for _, name := range reg.Names() {
+			if !strings.HasPrefix(name, pattern) {
+				continue
+			}
+			found = true
+			b, _ := reg.Lookup(name)
+			usage, desc, _ := strings.Cut(b.Help(), "\n")
+			fmt.Fprintf(c.stdio.Out, "%s: %s\n", name, usage)
+			for _, line := range strings.Split(desc, "\n") {
+				if line != "" {
+					fmt.Fprintf(c.stdio.Out, "    %s\n", line)
+				}
+			}
+		}
+		if !found {
+			fmt.Fprintf(c.stdio.Err, "help: no help topics match `%s'\n", pattern)
+			status = 1
+		}
+	}
+	if status != 0 {
+		return statusError(status)
+	}
+	return nil
+}
+
+// withPrefix returns the words that start with prefix, sorted.
+func withPrefix(words []string, prefix string) []string {
+	var res []string
+	for _, w := range words {
+		if strings.HasPrefix(w, prefix) {
+			res = append(res, w)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+func optionNames(shopt bool) []string {
+	var names []string
+	for _, opt := range options(shopt) {
+		names = append(names, opt.String())
+	}
+	return names
+}
+
+func completeShopt(args []string) []string {
+	last := args[len(args)-1]
+	if strings.HasPrefix(last, "-") {
+		return nil
+	}
+	return withPrefix(optionNames(!hasWord(args, "-o")), last)
+}
+
+func completeSet(args []string) []string {
+	if len(args) < 2 {
+		return nil
+	}
+	if prev := args[len(args)-2]; prev != "-o" && prev != "+o" {
+		return nil
+	}
+	return withPrefix(optionNames(false), args[len(args)-1])
+}
+
+func completeTrap(args []string) []string {
+	// the first word is the action
+	if len(args) < 2 {
+		return nil
+	}
+	var names []string
+	names = append(names, pseudoSignals...)
+	for _, s := range signalNames {
+		names = append(names, s.name)
+	}
+	return withPrefix(names, args[len(args)-1])
+}
+
+func hasWord(words []string, w string) bool {
+	for _, word := range words {
+		if word == w {
+			return true
+		}
+	}
+	return false
+}
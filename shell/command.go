@@ -0,0 +1,537 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrExit = errors.New("exit")
+)
+
+// Stdio is what a builtin reads from and writes to, with the redirections
+// of the command applied.
+type Stdio struct {
+	In  io.Reader
+	Out io.Writer
+	Err io.Writer
+}
+
+type Redirect struct {
+	TokenType TokenType
+	FileName  string
+
+	// Target is the unexpanded file name word, FileName is filled in from
+	// it when the command starts.
+	Target Token
+
+	// Force is set for `>|`, which truncates the file even under noclobber.
+	Force bool
+}
+
+type Redirects struct {
+	RedirectOutput Redirect
+	RedirectErr    Redirect
+	RedirectIn     Redirect
+}
+
+func (r *Redirects) hasRedirect() bool {
+	return r.RedirectOutput.TokenType != 0 || r.RedirectErr.TokenType != 0 || r.RedirectIn.TokenType != 0
+}
+
+// expandRedirects expands the target words of the redirections.
+func (r *Redirects) expandRedirects(sh *Shell) error {
+	for _, rd := range []*Redirect{&r.RedirectOutput, &r.RedirectErr, &r.RedirectIn} {
+		if rd.TokenType == 0 {
+			continue
+		}
+		name, err := sh.expandWord(rd.Target)
+		if err != nil {
+			return err
+		}
+		rd.FileName = name
+	}
+	return nil
+}
+
+type Command struct {
+	// Words and Assigns are the words as parsed, Args is filled in by
+	// expanding Words when the command starts.
+	Words   []Token
+	Assigns []Token
+	Args    []string
+	Redirects
+	// Line is the line of the source the command starts on.
+	Line int
+
+	Stdin  *os.File
+	Stdout *os.File
+	Stderr *os.File
+
+	// files are the standard files after the redirections, stdio is the
+	// same as seen by builtins.
+	files      ioFiles
+	stdio      Stdio
+	closeFiles func()
+
+	assigns  []string
+	waitFunc func() error
+	restore  func()
+	// release is called once the command holds no more references to its
+	// pipe ends: right after an external command started, or when a
+	// builtin is done.
+	release func()
+	sh      *Shell
+}
+
+func NewCommand(sh *Shell) *Command {
+	return &Command{
+		Args:      nil,
+		Redirects: Redirects{},
+		Stdin:     os.Stdin,
+		Stdout:    os.Stdout,
+		Stderr:    os.Stderr,
+		sh:        sh,
+	}
+}
+
+// Stdio returns the input and output of the command with its
+// redirections applied, for builtins to use.
+func (c *Command) Stdio() Stdio {
+	return c.stdio
+}
+
+func (c *Command) Start() error {
+	c.sh.lineno = c.Line
+	prefix := c.sh.errorPrefix()
+
+	err := c.expand()
+	if err != nil {
+		fmt.Fprintf(c.Stderr, "%s%s\n", prefix, err)
+		if err := c.sh.expansionError(err); err != nil {
+			return err
+		}
+		return statusError(1)
+	}
+	if c.sh.opts.Get(OptXtrace) {
+		c.sh.trace(c.Stderr, c.assigns, c.Args)
+	}
+
+	files, closeFiles, err := c.sh.applyRedirects(c.Redirects, ioFiles{stdin: c.Stdin, stdout: c.Stdout, stderr: c.Stderr})
+	if err != nil {
+		fmt.Fprintf(c.Stderr, "%s%s\n", prefix, err)
+		return statusError(1)
+	}
+	c.files = files
+	c.stdio = Stdio{In: files.stdin, Out: files.stdout, Err: files.stderr}
+	if prefix != "" {
+		c.stdio.Err = &prefixWriter{w: files.stderr, prefix: prefix}
+	}
+	c.closeFiles = closeFiles
+
+	if len(c.Args) == 0 {
+		c.assign()
+		closeFiles()
+		return nil
+	}
+
+	l := c.unwrap()
+	if len(c.Args) == 0 {
+		closeFiles()
+		return nil
+	}
+	cmdName := c.Args[0]
+
+	if fn, ok := c.sh.funcs[cmdName]; ok && l.funcs {
+		c.assignTemp()
+		return c.startFunction(fn)
+	}
+
+	if b, ok := c.sh.builtins.Lookup(cmdName); ok {
+		c.assignTemp()
+		return c.startInternal(func() error {
+			return b.Run(c.sh.ctx, c)
+		})
+	}
+
+	if !l.external {
+		fmt.Fprintf(c.stdio.Err, "builtin: %s: not a shell builtin\n", cmdName)
+		closeFiles()
+		return statusError(1)
+	}
+	err = c.startExternal(l.defaultPath)
+	if err != nil {
+		closeFiles()
+	}
+	return err
+}
+
+// lookup tells where the name of a command is searched.
+type lookup struct {
+	funcs    bool
+	external bool
+	// defaultPath searches the standard PATH, for `command -p`.
+	defaultPath bool
+}
+
+// unwrap removes the `command` and `builtin` words in front of a command,
+// which only change how the next word is looked up. `command -v` and `-V`
+// are left to the builtin.
+func (c *Command) unwrap() lookup {
+	l := lookup{funcs: true, external: true}
+	for len(c.Args) > 0 {
+		switch c.Args[0] {
+		case "builtin":
+			l.funcs, l.external = false, false
+			c.Args = c.Args[1:]
+		case "command":
+			i := 1
+			defaultPath := false
+			for ; i < len(c.Args) && len(c.Args[i]) > 1 && c.Args[i][0] == '-'; i++ {
+				if c.Args[i] == "--" {
+					i++
+					break
+				}
+				if strings.Trim(c.Args[i][1:], "p") != "" {
+					// -v, -V or an invalid option
+					return l
+				}
+				defaultPath = true
+			}
+			l.funcs = false
+			l.defaultPath = l.defaultPath || defaultPath
+			c.Args = c.Args[i:]
+		default:
+			return l
+		}
+	}
+	return l
+}
+
+func (c *Command) Wait() error {
+	if len(c.Args) == 0 {
+		return nil
+	}
+
+	if c.restore != nil {
+		defer c.restore()
+	}
+
+	if c.waitFunc != nil {
+		err := c.waitFunc()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expand fills in Args and the redirection file names from the parsed
+// words.
+func (c *Command) expand() error {
+	args, err := c.sh.expandWords(c.Words)
+	if err != nil {
+		return err
+	}
+	c.Args = args
+
+	c.assigns = c.assigns[:0]
+	for _, w := range c.Assigns {
+		name, value, _ := strings.Cut(w.Raw, "=")
+		value, err = c.sh.expandAssign(value)
+		if err != nil {
+			return err
+		}
+		c.assigns = append(c.assigns, name+"="+value)
+	}
+
+	return c.expandRedirects(c.sh)
+}
+
+// assign handles a command made only of assignments, they go to the shell
+// itself. The redirections have been performed already.
+func (c *Command) assign() {
+	for _, kv := range c.assigns {
+		name, value, _ := strings.Cut(kv, "=")
+		c.sh.setVar(name, value)
+	}
+}
+
+// assignTemp applies the assignments in front of a builtin for as long as
+// it runs, Wait puts the old values back.
+func (c *Command) assignTemp() {
+	if len(c.assigns) == 0 {
+		return
+	}
+
+	saved := make(map[string]*Variable)
+	for _, kv := range c.assigns {
+		name, value, _ := strings.Cut(kv, "=")
+		if _, ok := saved[name]; !ok {
+			if v, ok := c.sh.vars[name]; ok {
+				old := *v
+				saved[name] = &old
+			} else {
+				saved[name] = nil
+			}
+		}
+		c.sh.setVar(name, value)
+	}
+
+	c.restore = func() {
+		for name, v := range saved {
+			if v == nil {
+				c.sh.unsetVar(name)
+			} else {
+				c.sh.vars[name] = v
+			}
+		}
+	}
+}
+
+func (c *Command) startExternal(defaultPath bool) error {
+	cmdName := c.Args[0]
+	options := c.Args[1:]
+
+	absPath, err := c.sh.commandPath(cmdName, defaultPath)
+	if err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			fmt.Fprintf(c.stdio.Err, "%s: command not found\n", cmdName)
+			return statusError(127)
+		}
+		fmt.Fprintf(c.stdio.Err, "%s: %v\n", cmdName, err)
+		return statusError(126)
+	}
+
+	execCmd := exec.CommandContext(c.sh.ctx, absPath, options...)
+
+	// Set argv to use original command name as argv[0]
+	execCmd.Args[0] = cmdName
+	execCmd.Env = c.sh.environ(c.assigns...)
+	execCmd.Dir = c.sh.dir
+
+	execCmd.Stdin = c.files.stdin
+	execCmd.Stdout = c.files.stdout
+	execCmd.Stderr = c.files.stderr
+
+	job := c.sh.job
+	if c.sh.jobControl && job != nil {
+		execCmd.SysProcAttr = c.sh.jobProcAttr(job)
+	}
+
+	err = execCmd.Start()
+	if err != nil {
+		fmt.Fprintf(c.stdio.Err, "%s: %v\n", cmdName, err)
+		return statusError(126)
+	}
+	// the child has its own copies now
+	c.closeFiles()
+	if c.release != nil {
+		c.release()
+	}
+	c.waitFunc = execCmd.Wait
+	if job == nil {
+		return nil
+	}
+
+	job.addPid(execCmd.Process.Pid)
+	if c.sh.jobControl {
+		if execCmd.SysProcAttr.Pgid == 0 {
+			job.setPgid(execCmd.Process.Pid)
+		}
+		// exec.Cmd.Wait does not see a stopped process
+		c.waitFunc = func() error {
+			return waitProcess(execCmd.Process, job)
+		}
+	}
+	return nil
+}
+
+func (c *Command) startInternal(run func() error) error {
+	errChan := make(chan error, 1)
+
+	go func() {
+		var err error
+		defer func() {
+			if e := recover(); e != nil {
+				err = fmt.Errorf("panic: %v", e)
+			}
+			c.closeFiles()
+			if c.release != nil {
+				c.release()
+			}
+			errChan <- err
+		}()
+
+		err = run()
+		var status statusError
+		if err != nil && !isControlErr(err) && !errors.As(err, &status) {
+			// builtins report their own failures, anything else is said here
+			fmt.Fprintf(c.stdio.Err, "%s: %v\n", c.Args[0], err)
+		}
+	}()
+
+	c.waitFunc = func() error {
+		err := <-errChan
+		return err
+	}
+	return nil
+}
+
+func (c *Command) execShopt() error {
+	var (
+		set     bool
+		unset   bool
+		quiet   bool
+		setOpts bool
+		names   []string
+	)
+	for _, arg := range c.Args[1:] {
+		switch arg {
+		case "-s":
+			set = true
+		case "-u":
+			unset = true
+		case "-q":
+			quiet = true
+		case "-o":
+			setOpts = true
+		default:
+			names = append(names, arg)
+		}
+	}
+
+	if len(names) == 0 {
+		for _, opt := range options(!setOpts) {
+			on := c.sh.opts.Get(opt)
+			if (set && !on) || (unset && on) {
+				continue
+			}
+			fmt.Fprintf(c.stdio.Out, "%-15s\t%s\n", opt, onOff(on))
+		}
+		return nil
+	}
+
+	status := 0
+	for _, name := range names {
+		opt, ok := lookupOption(name, !setOpts)
+		if !ok {
+			fmt.Fprintf(c.stdio.Err, "shopt: %s: invalid shell option name\n", name)
+			status = 1
+			continue
+		}
+		on := c.sh.opts.Get(opt)
+		switch {
+		case set:
+			c.sh.opts.Set(opt, true)
+		case unset:
+			c.sh.opts.Set(opt, false)
+		case !on:
+			status = 1
+			fallthrough
+		default:
+			if !quiet {
+				fmt.Fprintf(c.stdio.Out, "%-15s\t%s\n", name, onOff(on))
+			}
+		}
+	}
+	if status != 0 {
+		return statusError(status)
+	}
+	return nil
+}
+
+func (c *Command) execExit() error {
+	if len(c.Args) >= 2 {
+		n, err := strconv.Atoi(c.Args[1])
+		if err != nil {
+			fmt.Fprintf(c.stdio.Err, "exit: %s: numeric argument required\n", c.Args[1])
+			n = 2
+		}
+		c.sh.lastStatus = n & 0xff
+	}
+	return ErrExit
+}
+
+func (c *Command) execHistory() error {
+	var limit = -1
+	if len(c.Args) >= 2 {
+		arg1 := c.Args[1]
+		if arg1 == "-r" {
+			if len(c.Args) >= 3 {
+				err := c.sh.readHistory(c.sh.abs(c.Args[2]))
+				if err != nil {
+					return err
+				}
+				return nil
+			}
+		} else if arg1 == "-w" {
+			if len(c.Args) >= 3 {
+				err := c.sh.dumpHistory(c.sh.abs(c.Args[2]))
+				if err != nil {
+					return err
+				}
+				return nil
+			}
+		} else if arg1 == "-a" {
+			if len(c.Args) >= 3 {
+				arg2 := c.Args[2]
+				historyFile, err := os.OpenFile(c.sh.abs(arg2), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+				if err != nil {
+					return err
+				}
+				defer historyFile.Close()
+				for _, history := range c.sh.appendHistoryList {
+					fmt.Fprintf(historyFile, "%s\n", history)
+				}
+				c.sh.appendHistoryList = nil
+				return nil
+			}
+		} else {
+			limitI64, err := strconv.ParseInt(arg1, 10, 64)
+			if err != nil {
+				return err
+			}
+			limit = int(limitI64)
+			if limit > len(c.sh.historyList) {
+				limit = len(c.sh.historyList)
+			}
+		}
+	}
+
+	historyToPrint := c.sh.historyList
+	offset := 1
+	if limit >= 0 {
+		t := len(historyToPrint) - limit
+		offset = t + 1
+		historyToPrint = historyToPrint[t:]
+	}
+
+	for idx, history := range historyToPrint {
+		fmt.Fprintf(c.stdio.Out, "    %d  %s\n", idx+offset, history)
+	}
+	return nil
+}
+
+// openRedirect opens the file of a redirection, for reading, truncating or
+// appending depending on the operator.
+func (sh *Shell) openRedirect(rd Redirect) (*os.File, error) {
+	name := sh.abs(rd.FileName)
+	switch rd.TokenType {
+	case TokenRedirectOut, TokenRedirectErr:
+		if sh.opts.Get(OptNoclobber) && !rd.Force {
+			if fi, err := os.Stat(name); err == nil && fi.Mode().IsRegular() {
+				return nil, errors.New("cannot overwrite existing file")
+			}
+		}
+		return os.Create(name)
+	case TokenRedirectOutAppend, TokenRedirectErrAppend:
+		return os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	}
+	return os.Open(name)
+}
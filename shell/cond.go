@@ -0,0 +1,431 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/chzyer/readline"
+	"github.com/codecrafters-io/shell-starter-go/internal"
+)
+
+var (
+	unaryTestOps = map[string]bool{
+		"-a": true, "-b": true, "-c": true, "-d": true, "-e": true, "-f": true,
+		"-g": true, "-h": true, "-k": true, "-p": true, "-r": true, "-s": true,
+		"-t": true, "-u": true, "-w": true, "-x": true, "-G": true, "-L": true,
+		"-N": true, "-O": true, "-S": true, "-n": true, "-z": true, "-v": true,
+	}
+
+	binaryTestOps = map[string]bool{
+		"=": true, "==": true, "!=": true, "<": true, ">": true,
+		"-eq": true, "-ne": true, "-lt": true, "-le": true, "-gt": true, "-ge": true,
+		"-nt": true, "-ot": true, "-ef": true,
+	}
+
+	// condBinaryOps adds the regex match that only [[ ]] knows about.
+	condBinaryOps = func() map[string]bool {
+		ops := map[string]bool{"=~": true}
+		for op := range binaryTestOps {
+			ops[op] = true
+		}
+		return ops
+	}()
+)
+
+func (sh *Shell) runCond(c *CondCommand, files ioFiles) error {
+	ok, err := sh.evalCond(c.Expr)
+	switch {
+	case err != nil:
+		fmt.Fprintf(files.stderr, "%s\n", err)
+		if errors.Is(err, errUnbound) {
+			return sh.expansionError(err)
+		}
+		sh.lastStatus = 2
+	case ok:
+		sh.lastStatus = 0
+	default:
+		sh.lastStatus = 1
+	}
+	return nil
+}
+
+// evalCond evaluates a [[ ]] expression. Operands are expanded without
+// field splitting or pathname expansion, `&&` and `||` short-circuit.
+func (sh *Shell) evalCond(e *CondExpr) (bool, error) {
+	switch e.Op {
+	case "&&", "||":
+		x, err := sh.evalCond(e.X)
+		if err != nil || x == (e.Op == "||") {
+			return x, err
+		}
+		return sh.evalCond(e.Y)
+	case "!":
+		x, err := sh.evalCond(e.X)
+		return !x, err
+	case "(":
+		return sh.evalCond(e.X)
+	case "":
+		s, err := sh.expandWord(e.Words[0])
+		return s != "", err
+	}
+
+	left, err := sh.expandWord(e.Words[0])
+	if err != nil {
+		return false, err
+	}
+	if len(e.Words) == 1 {
+		return sh.unaryTest(e.Op, left)
+	}
+
+	fold := sh.opts.Get(OptNocasematch)
+	switch e.Op {
+	case "==", "=", "!=":
+		pattern, err := sh.expandPattern(e.Words[1])
+		if err != nil {
+			return false, err
+		}
+		return internal.Match(pattern, left, fold) == (e.Op != "!="), nil
+	case "=~":
+		f, err := sh.expandSingle(e.Words[1].Raw, false)
+		if err != nil {
+			return false, err
+		}
+		return sh.regexMatch(left, f.re.String(), fold)
+	}
+
+	right, err := sh.expandWord(e.Words[1])
+	if err != nil {
+		return false, err
+	}
+	return sh.binaryTest(e.Op, left, right)
+}
+
+// regexMatch matches s against an extended regular expression and stores
+// the match and its groups in BASH_REMATCH.
+func (sh *Shell) regexMatch(s, expr string, fold bool) (bool, error) {
+	if fold {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return false, fmt.Errorf("%s: invalid regular expression", expr)
+	}
+
+	m := re.FindStringSubmatch(s)
+	if m == nil {
+		sh.setArray("BASH_REMATCH", nil)
+		return false, nil
+	}
+	sh.setArray("BASH_REMATCH", m)
+	return true, nil
+}
+
+// unaryTest implements the unary operators shared by [[ ]] and test.
+func (sh *Shell) unaryTest(op, arg string) (bool, error) {
+	switch op {
+	case "-n":
+		return arg != "", nil
+	case "-z":
+		return arg == "", nil
+	case "-v":
+		_, ok := sh.getParam(arg)
+		return ok, nil
+	case "-t":
+		fd, err := strconv.Atoi(arg)
+		if err != nil {
+			return false, fmt.Errorf("%s: integer expression expected", arg)
+		}
+		return readline.IsTerminal(fd), nil
+	case "-h", "-L":
+		fi, err := os.Lstat(sh.abs(arg))
+		return err == nil && fi.Mode()&os.ModeSymlink != 0, nil
+	case "-r":
+		return syscall.Access(sh.abs(arg), 4) == nil, nil
+	case "-w":
+		return syscall.Access(sh.abs(arg), 2) == nil, nil
+	case "-x":
+		return syscall.Access(sh.abs(arg), 1) == nil, nil
+	}
+
+	fi, err := os.Stat(sh.abs(arg))
+	if err != nil {
+		return false, nil
+	}
+	mode := fi.Mode()
+	switch op {
+	case "-a", "-e":
+		return true, nil
+	case "-f":
+		return mode.IsRegular(), nil
+	case "-d":
+		return mode.IsDir(), nil
+	case "-s":
+		return fi.Size() > 0, nil
+	case "-b":
+		return mode&os.ModeDevice != 0 && mode&os.ModeCharDevice == 0, nil
+	case "-c":
+		return mode&os.ModeCharDevice != 0, nil
+	case "-p":
+		return mode&os.ModeNamedPipe != 0, nil
+	case "-S":
+		return mode&os.ModeSocket != 0, nil
+	case "-g":
+		return mode&os.ModeSetgid != 0, nil
+	case "-u":
+		return mode&os.ModeSetuid != 0, nil
+	case "-k":
+		return mode&os.ModeSticky != 0, nil
+	}
+
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return false, nil
+	}
+	switch op {
+	case "-O":
+		return int(st.Uid) == os.Geteuid(), nil
+	case "-G":
+		return int(st.Gid) == os.Getegid(), nil
+	case "-N":
+		return modifiedSinceRead(st), nil
+	}
+	return false, fmt.Errorf("%s: unary operator expected", op)
+}
+
+// binaryTest implements the binary operators shared by [[ ]] and test,
+// string equality compares literally here.
+func (sh *Shell) binaryTest(op, left, right string) (bool, error) {
+	switch op {
+	case "=", "==":
+		return left == right, nil
+	case "!=":
+		return left != right, nil
+	case "<":
+		return left < right, nil
+	case ">":
+		return left > right, nil
+	case "-nt", "-ot":
+		l, lerr := os.Stat(sh.abs(left))
+		r, rerr := os.Stat(sh.abs(right))
+		if op == "-ot" {
+			l, r, lerr, rerr = r, l, rerr, lerr
+		}
+		if lerr != nil {
+			return false, nil
+		}
+		return rerr != nil || l.ModTime().After(r.ModTime()), nil
+	case "-ef":
+		l, lerr := os.Stat(sh.abs(left))
+		r, rerr := os.Stat(sh.abs(right))
+		return lerr == nil && rerr == nil && os.SameFile(l, r), nil
+	}
+
+	a, err := parseTestInt(left)
+	if err != nil {
+		return false, err
+	}
+	b, err := parseTestInt(right)
+	if err != nil {
+		return false, err
+	}
+	switch op {
+	case "-eq":
+		return a == b, nil
+	case "-ne":
+		return a != b, nil
+	case "-lt":
+		return a < b, nil
+	case "-le":
+		return a <= b, nil
+	case "-gt":
+		return a > b, nil
+	case "-ge":
+		return a >= b, nil
+	}
+	return false, fmt.Errorf("%s: binary operator expected", op)
+}
+
+func parseTestInt(s string) (int64, error) {
+	n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: integer expression expected", s)
+	}
+	return n, nil
+}
+
+func (c *Command) execTest() error {
+	name := c.Args[0]
+	args := c.Args[1:]
+	if name == "[" {
+		if len(args) == 0 || args[len(args)-1] != "]" {
+			fmt.Fprintf(c.stdio.Err, "%s: missing `]'\n", name)
+			return statusError(2)
+		}
+		args = args[:len(args)-1]
+	}
+
+	ok, err := c.sh.evalTest(args)
+	if err != nil {
+		fmt.Fprintf(c.stdio.Err, "%s: %s\n", name, err)
+		return statusError(2)
+	}
+	if !ok {
+		return statusError(1)
+	}
+	return nil
+}
+
+// evalTest evaluates the arguments of test following the POSIX rules that
+// decide by argument count, and falls back to a precedence parser with
+// `!` over `-a` over `-o` for longer expressions.
+func (sh *Shell) evalTest(args []string) (bool, error) {
+	switch len(args) {
+	case 0:
+		return false, nil
+	case 1:
+		return args[0] != "", nil
+	case 2:
+		if args[0] == "!" {
+			return args[1] == "", nil
+		}
+		if unaryTestOps[args[0]] {
+			return sh.unaryTest(args[0], args[1])
+		}
+		return false, fmt.Errorf("%s: unary operator expected", args[0])
+	case 3:
+		if binaryTestOps[args[1]] {
+			return sh.binaryTest(args[1], args[0], args[2])
+		}
+		if args[1] == "-a" || args[1] == "-o" {
+			break
+		}
+		if args[0] == "!" {
+			ok, err := sh.evalTest(args[1:])
+			return !ok, err
+		}
+		if args[0] == "(" && args[2] == ")" {
+			return args[1] != "", nil
+		}
+		return false, fmt.Errorf("%s: binary operator expected", args[1])
+	case 4:
+		if args[0] == "!" {
+			ok, err := sh.evalTest(args[1:])
+			return !ok, err
+		}
+		if args[0] == "(" && args[3] == ")" {
+			return sh.evalTest(args[1:3])
+		}
+	}
+
+	tp := &testParser{sh: sh, args: args}
+	ok, err := tp.parseOr()
+	if err != nil {
+		return false, err
+	}
+	if tp.pos < len(tp.args) {
+		return false, fmt.Errorf("%s: unexpected argument", tp.args[tp.pos])
+	}
+	return ok, nil
+}
+
+type testParser struct {
+	sh   *Shell
+	args []string
+	pos  int
+}
+
+func (tp *testParser) peek(n int) (string, bool) {
+	if tp.pos+n >= len(tp.args) {
+		return "", false
+	}
+	return tp.args[tp.pos+n], true
+}
+
+func (tp *testParser) parseOr() (bool, error) {
+	x, err := tp.parseAnd()
+	if err != nil {
+		return false, err
+	}
+	for {
+		if arg, ok := tp.peek(0); !ok || arg != "-o" {
+			return x, nil
+		}
+		tp.pos++
+		y, err := tp.parseAnd()
+		if err != nil {
+			return false, err
+		}
+		x = x || y
+	}
+}
+
+func (tp *testParser) parseAnd() (bool, error) {
+	x, err := tp.parseNot()
+	if err != nil {
+		return false, err
+	}
+	for {
+		if arg, ok := tp.peek(0); !ok || arg != "-a" {
+			return x, nil
+		}
+		tp.pos++
+		y, err := tp.parseNot()
+		if err != nil {
+			return false, err
+		}
+		x = x && y
+	}
+}
+
+func (tp *testParser) parseNot() (bool, error) {
+	if arg, ok := tp.peek(0); ok && arg == "!" {
+		tp.pos++
+		x, err := tp.parseNot()
+		return !x, err
+	}
+	return tp.parsePrimary()
+}
+
+func (tp *testParser) parsePrimary() (bool, error) {
+	arg, ok := tp.peek(0)
+	if !ok {
+		return false, fmt.Errorf("argument expected")
+	}
+
+	if arg == "(" {
+		tp.pos++
+		x, err := tp.parseOr()
+		if err != nil {
+			return false, err
+		}
+		if closing, ok := tp.peek(0); !ok || closing != ")" {
+			return false, fmt.Errorf("`)' expected")
+		}
+		tp.pos++
+		return x, nil
+	}
+
+	if op, ok := tp.peek(1); ok && binaryTestOps[op] {
+		right, ok := tp.peek(2)
+		if !ok {
+			return false, fmt.Errorf("%s: argument expected", op)
+		}
+		tp.pos += 3
+		return tp.sh.binaryTest(op, arg, right)
+	}
+
+	if unaryTestOps[arg] {
+		if operand, ok := tp.peek(1); ok {
+			tp.pos += 2
+			return tp.sh.unaryTest(arg, operand)
+		}
+	}
+
+	tp.pos++
+	return arg != "", nil
+}
@@ -0,0 +1,9 @@
+package shell
+
+import "syscall"
+
+// modifiedSinceRead reports whether the file was written after it was last
+// read, for -N.
+func modifiedSinceRead(st *syscall.Stat_t) bool {
+	return st.Mtim.Nano() > st.Atim.Nano()
+}
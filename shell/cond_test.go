@@ -0,0 +1,45 @@
+package shell
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEvalTest(t *testing.T) {
+	sh := New(Config{})
+
+	cases := []struct {
+		args string
+		want bool
+	}{
+		{"", false},
+		{"x", true},
+		{"! x", false},
+		{"-z x", false},
+		{"-d /", true},
+		{"-f /", false},
+		{"a = a", true},
+		{"a != a", false},
+		{"2 -lt 10", true},
+		{"! -d /", false},
+		{"( a = b )", false},
+		{"a = a -a 1 -gt 2", false},
+		{"a = b -o 1 -le 2", true},
+		{"! ( a = b ) -a -d /", true},
+		{"x -a ! y -o z", true},
+	}
+	for _, c := range cases {
+		ok, err := sh.evalTest(strings.Fields(c.args))
+		if err != nil {
+			t.Errorf("%q: %v", c.args, err)
+			continue
+		}
+		if ok != c.want {
+			t.Errorf("%q: got %v, want %v", c.args, ok, c.want)
+		}
+	}
+
+	if _, err := sh.evalTest([]string{"1", "-eq", "x"}); err == nil {
+		t.Errorf("expected an error for a non-integer operand")
+	}
+}
@@ -0,0 +1,258 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// initDir sets the shell's working directory to dir, or to the process's
+// when dir is empty. An inherited PWD naming the same directory is kept,
+// it may go through symlinks.
+func (sh *Shell) initDir(dir string) error {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	if dir != "" {
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(cwd, dir)
+		}
+		dir = filepath.Clean(dir)
+		if err := checkDir(dir); err != nil {
+			return err
+		}
+		sh.dir = dir
+	} else {
+		sh.dir = cwd
+		if pwd, ok := sh.getVar("PWD"); ok && filepath.IsAbs(pwd) && sameFile(pwd, cwd) {
+			sh.dir = filepath.Clean(pwd)
+		}
+	}
+	sh.setVar("PWD", sh.dir)
+	sh.vars["PWD"].Exported = true
+	return nil
+}
+
+// abs resolves path against the shell's working directory. The empty path
+// names no file and stays empty.
+func (sh *Shell) abs(path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(sh.dir, path)
+}
+
+// chdir makes dir, an absolute path, the working directory and updates PWD
+// and OLDPWD.
+func (sh *Shell) chdir(dir string) error {
+	if err := checkDir(dir); err != nil {
+		return err
+	}
+	sh.setVar("OLDPWD", sh.dir)
+	sh.dir = dir
+	sh.setVar("PWD", dir)
+	if sh.trackDirs {
+		sh.recordDir(dir)
+	}
+	return nil
+}
+
+// checkDir reports whether dir is a directory the shell can change to.
+func checkDir(dir string) error {
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return &fs.PathError{Op: "chdir", Path: dir, Err: syscall.ENOTDIR}
+	}
+	if err := syscall.Access(dir, 1); err != nil {
+		return &fs.PathError{Op: "chdir", Path: dir, Err: err}
+	}
+	return nil
+}
+
+// physicalPath resolves the symlinks of dir, relative to the shell's
+// working directory. A `..` goes to the parent of what the component
+// before it points to.
+func (sh *Shell) physicalPath(dir string) (string, error) {
+	if !filepath.IsAbs(dir) {
+		dir = sh.dir + "/" + dir
+	}
+	return filepath.EvalSymlinks(dir)
+}
+
+func sameFile(a, b string) bool {
+	fa, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	fb, err := os.Stat(b)
+	return err == nil && os.SameFile(fa, fb)
+}
+
+// errorReason describes err the way the shell reports a failed system call.
+func errorReason(err error) string {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return "No such file or directory"
+	case errors.Is(err, fs.ErrPermission):
+		return "Permission denied"
+	case errors.Is(err, syscall.ENOTDIR):
+		return "Not a directory"
+	case errors.Is(err, syscall.ELOOP):
+		return "Too many levels of symbolic links"
+	}
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return pathErr.Err.Error()
+	}
+	return err.Error()
+}
+
+// physicalFlag parses the -L and -P options of cd and pwd, the last one
+// wins. It returns the remaining arguments.
+func physicalFlag(name, usage string, args []string, stderr io.Writer) (bool, []string, error) {
+	physical := false
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+		arg := args[0]
+		args = args[1:]
+		if arg == "--" {
+			break
+		}
+		for _, f := range arg[1:] {
+			switch f {
+			case 'L':
+				physical = false
+			case 'P':
+				physical = true
+			default:
+				fmt.Fprintf(stderr, "%s: -%c: invalid option\n", name, f)
+				fmt.Fprintf(stderr, "%s: usage: %s\n", name, usage)
+				return false, nil, statusError(2)
+			}
+		}
+	}
+	return physical, args, nil
+}
+
+func (c *Command) execPwd() error {
+	physical, _, err := physicalFlag("pwd", "pwd [-LP]", c.Args[1:], c.stdio.Err)
+	if err != nil {
+		return err
+	}
+
+	dir := c.sh.dir
+	if physical {
+		dir, err = c.sh.physicalPath(dir)
+		if err != nil {
+			fmt.Fprintf(c.stdio.Err, "pwd: error retrieving current directory: %s\n", errorReason(err))
+			return statusError(1)
+		}
+	}
+	fmt.Fprintln(c.stdio.Out, dir)
+	return nil
+}
+
+func (c *Command) execCd() error {
+	physical, args, err := physicalFlag("cd", "cd [-L|-P] [dir]", c.Args[1:], c.stdio.Err)
+	if err != nil {
+		return err
+	}
+
+	var dir string
+	// the new directory is printed when it is not the one given
+	print := false
+	switch {
+	case len(args) > 1:
+		fmt.Fprintln(c.stdio.Err, "cd: too many arguments")
+		return statusError(1)
+	case len(args) == 0:
+		home, ok := c.sh.getVar("HOME")
+		if !ok {
+			fmt.Fprintln(c.stdio.Err, "cd: HOME not set")
+			return statusError(1)
+		}
+		dir = home
+	case args[0] == "-":
+		old, ok := c.sh.getVar("OLDPWD")
+		if !ok {
+			fmt.Fprintln(c.stdio.Err, "cd: OLDPWD not set")
+			return statusError(1)
+		}
+		dir = old
+		print = true
+	default:
+		dir = args[0]
+	}
+	if dir == "" {
+		return nil
+	}
+
+	if found, ok := c.sh.searchCdpath(dir); ok {
+		dir = found
+		print = true
+	}
+	if err := c.changeDir(dir, physical); err != nil {
+		return err
+	}
+	if print {
+		fmt.Fprintln(c.stdio.Out, c.sh.dir)
+	}
+	return nil
+}
+
+// changeDir changes the working directory to dir, resolving its symlinks
+// if physical is set. Failures are reported under the command's name.
+func (c *Command) changeDir(dir string, physical bool) error {
+	var err error
+	target := filepath.Clean(c.sh.abs(dir))
+	if physical {
+		target, err = c.sh.physicalPath(dir)
+	} else if err = checkDir(target); err != nil {
+		// a logical path with `..` after a symlink may not exist, the
+		// physical one is tried before giving up
+		if p, perr := c.sh.physicalPath(dir); perr == nil {
+			target, err = p, nil
+		}
+	}
+	if err == nil {
+		err = c.sh.chdir(target)
+	}
+	if err != nil {
+		fmt.Fprintf(c.stdio.Err, "%s: %s: %s\n", c.Args[0], dir, errorReason(err))
+		return statusError(1)
+	}
+	return nil
+}
+
+// searchCdpath looks for dir in the directories of CDPATH. Absolute paths
+// and those starting with . or .. are not searched.
+func (sh *Shell) searchCdpath(dir string) (string, bool) {
+	cdpath, ok := sh.getVar("CDPATH")
+	if !ok || cdpath == "" || filepath.IsAbs(dir) || dir == "." || dir == ".." ||
+		strings.HasPrefix(dir, "./") || strings.HasPrefix(dir, "../") {
+		return "", false
+	}
+
+	for _, base := range filepath.SplitList(cdpath) {
+		if base == "" {
+			// an empty entry is the current directory, found silently
+			if checkDir(sh.abs(dir)) == nil {
+				return "", false
+			}
+			continue
+		}
+		candidate := filepath.Join(base, dir)
+		if checkDir(sh.abs(candidate)) == nil {
+			return sh.abs(candidate), true
+		}
+	}
+	return "", false
+}
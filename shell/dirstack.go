@@ -0,0 +1,258 @@
+package shell
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// dirs returns the directory stack as dirs shows it, the working directory
+// first.
+func (sh *Shell) dirs() []string {
+	return append([]string{sh.dir}, sh.dirStack...)
+}
+
+// stackIndex turns +N, counting from the left of `dirs` starting at zero,
+// or -N, counting from the right, into an index of sh.dirs().
+func (sh *Shell) stackIndex(arg string) (int, bool) {
+	if len(arg) < 2 || (arg[0] != '+' && arg[0] != '-') {
+		return 0, false
+	}
+	n, err := strconv.Atoi(arg[1:])
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	size := len(sh.dirStack) + 1
+	if n >= size {
+		return -1, true
+	}
+	if arg[0] == '-' {
+		n = size - 1 - n
+	}
+	return n, true
+}
+
+// tildeStack expands the part of ~+, ~- and ~N, ~+N or ~-N after the
+// tilde: the working directory, OLDPWD or an entry of the stack.
+func (sh *Shell) tildeStack(prefix string) (string, bool) {
+	switch prefix {
+	case "+":
+		return sh.dir, true
+	case "-":
+		return sh.getVar("OLDPWD")
+	}
+	if prefix[0] != '+' && prefix[0] != '-' {
+		prefix = "+" + prefix
+	}
+	n, ok := sh.stackIndex(prefix)
+	if !ok || n < 0 {
+		return "", false
+	}
+	return sh.dirs()[n], true
+}
+
+// tildeDir abbreviates the home directory at the start of dir to ~.
+func (sh *Shell) tildeDir(dir string) string {
+	home, ok := sh.getVar("HOME")
+	if !ok || home == "" || home == "/" {
+		return dir
+	}
+	if dir == home {
+		return "~"
+	}
+	if rest, ok := strings.CutPrefix(dir, home+"/"); ok {
+		return "~/" + rest
+	}
+	return dir
+}
+
+func (sh *Shell) printDirs(c *Command) {
+	names := make([]string, 0, len(sh.dirStack)+1)
+	for _, dir := range sh.dirs() {
+		names = append(names, sh.tildeDir(dir))
+	}
+	fmt.Fprintln(c.stdio.Out, strings.Join(names, " "))
+}
+
+func (c *Command) execDirs() error {
+	var (
+		clear    bool
+		long     bool
+		perLine  bool
+		numbered bool
+		index    = -1
+	)
+	for _, arg := range c.Args[1:] {
+		if n, ok := c.sh.stackIndex(arg); ok {
+			if n < 0 {
+				fmt.Fprintf(c.stdio.Err, "dirs: %s: directory stack index out of range\n", arg)
+				return statusError(1)
+			}
+			index = n
+			continue
+		}
+		if len(arg) < 2 || arg[0] != '-' {
+			fmt.Fprintf(c.stdio.Err, "dirs: %s: invalid argument\n", arg)
+			fmt.Fprintln(c.stdio.Err, "dirs: usage: dirs [-clpv] [+N] [-N]")
+			return statusError(2)
+		}
+		for _, f := range arg[1:] {
+			switch f {
+			case 'c':
+				clear = true
+			case 'l':
+				long = true
+			case 'p':
+				perLine = true
+			case 'v':
+				numbered = true
+			default:
+				fmt.Fprintf(c.stdio.Err, "dirs: -%c: invalid option\n", f)
+				fmt.Fprintln(c.stdio.Err, "dirs: usage: dirs [-clpv] [+N] [-N]")
+				return statusError(2)
+			}
+		}
+	}
+
+	if clear {
+		c.sh.dirStack = nil
+		return nil
+	}
+
+	dirs := c.sh.dirs()
+	if !long {
+		for i, dir := range dirs {
+			dirs[i] = c.sh.tildeDir(dir)
+		}
+	}
+	if index >= 0 {
+		fmt.Fprintln(c.stdio.Out, dirs[index])
+		return nil
+	}
+	switch {
+	case numbered:
+		for i, dir := range dirs {
+			fmt.Fprintf(c.stdio.Out, "%2d  %s\n", i, dir)
+		}
+	case perLine:
+		for _, dir := range dirs {
+			fmt.Fprintln(c.stdio.Out, dir)
+		}
+	default:
+		fmt.Fprintln(c.stdio.Out, strings.Join(dirs, " "))
+	}
+	return nil
+}
+
+// stackArgs parses the arguments shared by pushd and popd: -n, and at most
+// one more.
+func stackArgs(c *Command) (noCd bool, arg string, err error) {
+	var rest []string
+	args := c.Args[1:]
+	for i, a := range args {
+		if a == "--" {
+			rest = append(rest, args[i+1:]...)
+			break
+		}
+		if a == "-n" {
+			noCd = true
+			continue
+		}
+		rest = append(rest, a)
+	}
+	if len(rest) > 1 {
+		fmt.Fprintf(c.stdio.Err, "%s: too many arguments\n", c.Args[0])
+		return false, "", statusError(1)
+	}
+	if len(rest) == 1 {
+		arg = rest[0]
+	}
+	return noCd, arg, nil
+}
+
+func (c *Command) execPushd() error {
+	sh := c.sh
+	noCd, arg, err := stackArgs(c)
+	if err != nil {
+		return err
+	}
+
+	var dirs []string
+	switch n, ok := sh.stackIndex(arg); {
+	case arg == "":
+		// swap the top two directories
+		if len(sh.dirStack) == 0 {
+			fmt.Fprintln(c.stdio.Err, "pushd: no other directory")
+			return statusError(1)
+		}
+		dirs = sh.dirs()
+		dirs[0], dirs[1] = dirs[1], dirs[0]
+	case ok && n < 0:
+		fmt.Fprintf(c.stdio.Err, "pushd: %s: directory stack index out of range\n", arg)
+		return statusError(1)
+	case ok:
+		// rotate the Nth directory to the top
+		all := sh.dirs()
+		dirs = append(all[n:], all[:n]...)
+	case noCd:
+		// the new directory goes below the working directory
+		sh.dirStack = append([]string{filepath.Clean(sh.abs(arg))}, sh.dirStack...)
+		sh.printDirs(c)
+		return nil
+	default:
+		dirs = append([]string{arg}, sh.dirs()...)
+	}
+
+	if err := c.changeDir(dirs[0], false); err != nil {
+		return err
+	}
+	sh.dirStack = dirs[1:]
+	sh.printDirs(c)
+	return nil
+}
+
+func (c *Command) execPopd() error {
+	sh := c.sh
+	noCd, arg, err := stackArgs(c)
+	if err != nil {
+		return err
+	}
+	if len(sh.dirStack) == 0 {
+		fmt.Fprintln(c.stdio.Err, "popd: directory stack empty")
+		return statusError(1)
+	}
+
+	n := 0
+	if arg != "" {
+		var ok bool
+		n, ok = sh.stackIndex(arg)
+		if !ok {
+			fmt.Fprintf(c.stdio.Err, "popd: %s: invalid argument\n", arg)
+			fmt.Fprintln(c.stdio.Err, "popd: usage: popd [-n] [+N | -N]")
+			return statusError(2)
+		}
+		if n < 0 {
+			fmt.Fprintf(c.stdio.Err, "popd: %s: directory stack index out of range\n", arg)
+			return statusError(1)
+		}
+	}
+
+	if n > 0 {
+		sh.dirStack = append(sh.dirStack[:n-1:n-1], sh.dirStack[n:]...)
+		sh.printDirs(c)
+		return nil
+	}
+	if noCd {
+		// -n leaves the working directory and drops the entry below it
+		sh.dirStack = sh.dirStack[1:]
+		sh.printDirs(c)
+		return nil
+	}
+	if err := c.changeDir(sh.dirStack[0], false); err != nil {
+		return err
+	}
+	sh.dirStack = sh.dirStack[1:]
+	sh.printDirs(c)
+	return nil
+}
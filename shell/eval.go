@@ -0,0 +1,245 @@
+package shell
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Eval parses and runs src and returns the status of its last command. The
+// error is the parse error, ErrExit if src ran exit, or the context's error
+// if ctx was done before src finished.
+//
+// When Config.Stdout or Config.Stderr is not an *os.File, the output is
+// copied to it through a pipe, and Eval returns only once every background
+// job started by src has exited and closed the pipe.
+func (sh *Shell) Eval(ctx context.Context, src string) (int, error) {
+	p, err := sh.newParser(src, 1)
+	if err != nil {
+		sh.lastStatus = 2
+		return sh.lastStatus, err
+	}
+	return sh.eval(ctx, func(files ioFiles) error {
+		return sh.runLines(p, files)
+	})
+}
+
+// eval calls run with the shell's standard streams as files and returns the
+// status it leaves.
+func (sh *Shell) eval(ctx context.Context, run func(files ioFiles) error) (int, error) {
+	files, closeFiles, err := sh.openStdio()
+	if err != nil {
+		return sh.lastStatus, err
+	}
+	saved := sh.files
+	sh.files = files
+	sh.ctx = ctx
+	defer func() {
+		sh.files = saved
+		sh.ctx = context.Background()
+	}()
+
+	err = run(files)
+	closeFiles()
+	return sh.lastStatus, err
+}
+
+// runLines parses and runs the commands of p a line at a time, like a
+// script is read, so that an alias defined on one line applies to the
+// next. A syntax error stops it with status 2.
+func (sh *Shell) runLines(p *Parser, files ioFiles) error {
+	for {
+		prog, err := p.parseLine()
+		if err != nil {
+			sh.lastStatus = 2
+			return err
+		}
+		if prog == nil {
+			return nil
+		}
+		if sh.opts.Get(OptNoexec) {
+			continue
+		}
+		if err := sh.runList(prog, files); err != nil {
+			return err
+		}
+	}
+}
+
+// RunFile runs the script at path, as Eval. A script that cannot be read
+// gives status 127 and an *fs.PathError for path. Syntax errors name the
+// file and line. Like Eval, it waits for the background jobs of the script
+// when Config.Stdout or Config.Stderr is not an *os.File.
+func (sh *Shell) RunFile(ctx context.Context, path string) (int, error) {
+	src, err := os.ReadFile(sh.abs(path))
+	if err != nil {
+		var pathErr *fs.PathError
+		if errors.As(err, &pathErr) {
+			pathErr.Path = path
+		}
+		return 127, err
+	}
+	return sh.eval(ctx, func(files ioFiles) error {
+		return sh.runSource(path, string(src), files)
+	})
+}
+
+// RunReader reads commands from r and runs them as it goes, like a shell
+// reading a script from its standard input, and returns as Eval. Input is
+// read a byte at a time, a command reading the same input gets what follows
+// it. A syntax error ends the input with status 2.
+func (sh *Shell) RunReader(ctx context.Context, r io.Reader) (int, error) {
+	sh.inputName = sh.name
+	return sh.eval(ctx, func(files ioFiles) error {
+		return sh.readCommands(r, files)
+	})
+}
+
+// readCommands runs the commands of r, each one once its lines are
+// complete.
+func (sh *Shell) readCommands(r io.Reader, files ioFiles) error {
+	var (
+		pending string
+		line    = 1
+	)
+	for {
+		text, rerr := readLine(r)
+		pending += text
+
+		if strings.TrimSpace(pending) != "" {
+			p, err := sh.newParser(pending, line)
+			var prog *List
+			if err == nil {
+				prog, err = p.ParseProgram()
+			}
+			if errors.Is(err, errIncomplete) && rerr == nil {
+				continue
+			}
+			if err != nil {
+				sh.lastStatus = 2
+				errLine := line + strings.Count(pending, "\n")
+				if p != nil {
+					errLine = p.line()
+				}
+				return sourceError(sh.name, errLine, err)
+			}
+			if !sh.opts.Get(OptNoexec) {
+				if err := sh.runList(prog, files); err != nil {
+					return err
+				}
+			}
+			if err := sh.runPendingTraps(files); err != nil {
+				return err
+			}
+		}
+		line += strings.Count(pending, "\n")
+		pending = ""
+
+		if rerr == io.EOF {
+			return nil
+		}
+		if rerr != nil {
+			return rerr
+		}
+	}
+}
+
+// readLine reads up to and including the next newline, without reading
+// past it.
+func readLine(r io.Reader) (string, error) {
+	var (
+		sb  strings.Builder
+		buf [1]byte
+	)
+	for {
+		n, err := r.Read(buf[:])
+		if n > 0 {
+			sb.WriteByte(buf[0])
+			if buf[0] == '\n' {
+				return sb.String(), nil
+			}
+		}
+		if err != nil {
+			return sb.String(), err
+		}
+	}
+}
+
+// Exit runs the EXIT trap and returns the status the shell exits with.
+func (sh *Shell) Exit() int {
+	status, _ := sh.eval(context.Background(), func(files ioFiles) error {
+		sh.runExitTrap(files)
+		return nil
+	})
+	return status
+}
+
+// openStdio returns the files for the shell's standard streams. An output
+// stream that is not a file gets a pipe, copied to it until closeFiles is
+// called. An input stream that is not a file is copied into a pipe for the
+// life of the shell.
+func (sh *Shell) openStdio() (files ioFiles, closeFiles func(), err error) {
+	var (
+		wg     sync.WaitGroup
+		closes []func()
+	)
+	closeFiles = func() {
+		for _, c := range closes {
+			c()
+		}
+		wg.Wait()
+	}
+
+	if f, ok := sh.stdio.In.(*os.File); ok {
+		files.stdin = f
+	} else {
+		if sh.stdin == nil {
+			pr, pw, err := os.Pipe()
+			if err != nil {
+				return files, nil, err
+			}
+			// the copy stops at the end of the input, every Eval reads
+			// from the same pipe
+			go func(r io.Reader) {
+				io.Copy(pw, r)
+				pw.Close()
+			}(sh.stdio.In)
+			sh.stdin = pr
+		}
+		files.stdin = sh.stdin
+	}
+
+	for _, out := range []struct {
+		w io.Writer
+		f **os.File
+	}{
+		{sh.stdio.Out, &files.stdout},
+		{sh.stdio.Err, &files.stderr},
+	} {
+		if f, ok := out.w.(*os.File); ok {
+			*out.f = f
+			continue
+		}
+		pr, pw, err := os.Pipe()
+		if err != nil {
+			closeFiles()
+			return files, nil, err
+		}
+		wg.Add(1)
+		go func(w io.Writer) {
+			defer wg.Done()
+			io.Copy(w, pr)
+			pr.Close()
+		}(out.w)
+		*out.f = pw
+		// the copy ends when every writer, including background jobs
+		// still holding the pipe, is done
+		closes = append(closes, func() { pw.Close() })
+	}
+
+	return files, closeFiles, nil
+}
@@ -0,0 +1,303 @@
+package shell_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/shell-starter-go/shell"
+)
+
+func TestEval(t *testing.T) {
+	var out, errOut bytes.Buffer
+	reg := shell.DefaultRegistry()
+	reg.Register(&shell.BuiltinFunc{
+		BuiltinName: "shout",
+		Usage:       "shout word\nWrite word in upper case.",
+		Fn: func(ctx context.Context, c *shell.Command) error {
+			fmt.Fprintln(c.Stdio().Out, strings.ToUpper(c.Args[1]))
+			return nil
+		},
+	})
+	sh := shell.New(shell.Config{
+		Stdin:    strings.NewReader("from stdin\n"),
+		Stdout:   &out,
+		Stderr:   &errOut,
+		Env:      []string{"PATH=" + os.Getenv("PATH"), "GREETING=hi"},
+		Builtins: reg,
+		Name:     "embedded",
+		Args:     []string{"a", "b"},
+	})
+
+	ctx := context.Background()
+	status, err := sh.Eval(ctx, `cat; echo $GREETING $0 $#; shout quiet | tr A-Z a-z; nosuch-command; true & wait`)
+	if err != nil || status != 0 {
+		t.Fatalf("Eval: status %d, err %v", status, err)
+	}
+	if want := "from stdin\nhi embedded 2\nquiet\n"; out.String() != want {
+		t.Errorf("stdout: got %q, want %q", out.String(), want)
+	}
+	if want := "nosuch-command: command not found\n"; errOut.String() != want {
+		t.Errorf("stderr: got %q, want %q", errOut.String(), want)
+	}
+
+	status, err = sh.Eval(ctx, `x=1; false`)
+	if err != nil || status != 1 {
+		t.Errorf("false: status %d, err %v", status, err)
+	}
+	status, err = sh.Eval(ctx, `echo $x; exit 7`)
+	if !errors.Is(err, shell.ErrExit) || status != 7 {
+		t.Errorf("exit: status %d, err %v", status, err)
+	}
+	if _, err := sh.Eval(ctx, `echo )`); err == nil {
+		t.Error("expected a parse error")
+	}
+}
+
+func TestEvalSharedStdin(t *testing.T) {
+	var out bytes.Buffer
+	sh := shell.New(shell.Config{
+		Stdin:  strings.NewReader("one\ntwo\nthree\n"),
+		Stdout: &out,
+	})
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if status, err := sh.Eval(ctx, `read line; echo "$line"`); err != nil || status != 0 {
+			t.Fatalf("Eval %d: status %d, err %v", i, status, err)
+		}
+	}
+	if want := "one\ntwo\nthree\n"; out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+}
+
+func TestRunConfiguredStdio(t *testing.T) {
+	var out, errOut bytes.Buffer
+	sh := shell.New(shell.Config{
+		Stdin:  strings.NewReader("trap 'echo bye' EXIT\necho hi\nnosuch-command\n"),
+		Stdout: &out,
+		Stderr: &errOut,
+		Env:    []string{"PATH=" + os.Getenv("PATH"), "HISTFILE="},
+	})
+	sh.Run()
+	if status := sh.Exit(); status != 127 {
+		t.Errorf("status %d, want 127", status)
+	}
+	if !strings.Contains(out.String(), "hi\n") || !strings.HasSuffix(out.String(), "bye\n") {
+		t.Errorf("stdout: got %q", out.String())
+	}
+	if !strings.Contains(errOut.String(), "nosuch-command: command not found") {
+		t.Errorf("stderr: got %q", errOut.String())
+	}
+}
+
+func TestExitConfiguredStdout(t *testing.T) {
+	var out bytes.Buffer
+	sh := shell.New(shell.Config{Stdout: &out})
+	if _, err := sh.Eval(context.Background(), `trap 'echo bye' EXIT`); err != nil {
+		t.Fatal(err)
+	}
+	sh.Exit()
+	if out.String() != "bye\n" {
+		t.Errorf("got %q, want the EXIT trap's output", out.String())
+	}
+}
+
+func TestEvalContext(t *testing.T) {
+	sh := shell.New(shell.Config{})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := sh.Eval(ctx, "sleep 5; echo not reached")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want the context's error", err)
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("sleep ran for %v after the context was done", d)
+	}
+}
+
+func TestRunFile(t *testing.T) {
+	path := t.TempDir() + "/script.sh"
+	if err := os.WriteFile(path, []byte("f() { echo \"in $1\"; }\nf script\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	sh := shell.New(shell.Config{Stdout: &out})
+	if status, err := sh.RunFile(context.Background(), path); status != 0 || err != nil {
+		t.Fatalf("RunFile: status %d, err %v", status, err)
+	}
+	if want := "in script\n"; out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+}
+
+func TestSource(t *testing.T) {
+	dir := t.TempDir()
+	lib := "FOO=set\necho \"lib $# $1 $BASH_SOURCE $LINENO\"\nnosuch-command\nreturn 3\necho not reached\n"
+	if err := os.WriteFile(dir+"/lib.sh", []byte(lib), 0644); err != nil {
+		t.Fatal(err)
+	}
+	script := "echo \"$0 $1 $2\"\n. ./lib.sh x; echo \"$? $FOO $*\"\nsource lib.sh\necho $LINENO\necho )\necho after\n"
+	if err := os.WriteFile(dir+"/script.sh", []byte(script), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out, errOut bytes.Buffer
+	sh := shell.New(shell.Config{Stdout: &out, Stderr: &errOut, Dir: dir, Name: "script.sh", Args: []string{"a", "b"}})
+	sh.Eval(context.Background(), "PATH="+dir)
+	status, err := sh.RunFile(context.Background(), "script.sh")
+	if status != 2 || err == nil || err.Error() != "script.sh: line 5: syntax error near unexpected token `)'" {
+		t.Errorf("RunFile: status %d, err %v", status, err)
+	}
+	// a name without a slash is found in PATH
+	if want := "script.sh a b\nlib 1 x ./lib.sh 2\n3 set a b\nlib 2 a " + dir + "/lib.sh 2\n4\n"; out.String() != want {
+		t.Errorf("stdout: got %q, want %q", out.String(), want)
+	}
+	if want := "./lib.sh: line 3: nosuch-command: command not found\n" + dir + "/lib.sh: line 3: nosuch-command: command not found\n"; errOut.String() != want {
+		t.Errorf("stderr: got %q, want %q", errOut.String(), want)
+	}
+}
+
+func TestRunReader(t *testing.T) {
+	// commands read the rest of the input, which must be a file to share
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pr.Close()
+	go func() {
+		pw.WriteString("alias hi='echo hi'\nhi\nread x; echo \"[$x]\"\nthis line is read\nf() {\n  echo in f\n}\nf; nosuch-command\necho )\necho not reached\n")
+		pw.Close()
+	}()
+
+	var out, errOut bytes.Buffer
+	sh := shell.New(shell.Config{Stdin: pr, Stdout: &out, Stderr: &errOut, Name: "sh"})
+	status, err := sh.RunReader(context.Background(), pr)
+	if status != 2 || err == nil || err.Error() != "sh: line 8: syntax error near unexpected token `)'" {
+		t.Errorf("RunReader: status %d, err %v", status, err)
+	}
+	if want := "hi\n[this line is read]\nin f\n"; out.String() != want {
+		t.Errorf("stdout: got %q, want %q", out.String(), want)
+	}
+	if want := "sh: line 7: nosuch-command: command not found\n"; errOut.String() != want {
+		t.Errorf("stderr: got %q, want %q", errOut.String(), want)
+	}
+
+	out.Reset()
+	cfg := shell.Config{Stdout: &out}
+	cfg.Options.Set(shell.OptNoexec, true)
+	sh = shell.New(cfg)
+	if status, err := sh.RunReader(context.Background(), strings.NewReader("echo not run\n")); status != 0 || err != nil || out.Len() != 0 {
+		t.Errorf("noexec: status %d, err %v, output %q", status, err, out.String())
+	}
+}
+
+func TestRunStartup(t *testing.T) {
+	home := t.TempDir()
+	posix := shell.Config{Env: []string{"HOME=" + home, "ENV=$HOME/env.sh"}}
+	posix.Options.Set(shell.OptPosix, true)
+	files := map[string]string{
+		".myshellrc":       "alias ll='echo rc'\nnosuch-command\n",
+		".myshell_profile": "echo profile\n",
+		"env.sh":           "echo env\n",
+		"custom.sh":        "echo custom\n",
+	}
+	for name, src := range files {
+		if err := os.WriteFile(home+"/"+name, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		cfg         shell.Config
+		interactive bool
+		out, errOut string
+	}{
+		{"interactive", shell.Config{}, true, "rc\n", home + "/.myshellrc: line 2: nosuch-command: command not found\n"},
+		{"script", shell.Config{}, false, "", ""},
+		{"norc", shell.Config{NoRC: true}, true, "", ""},
+		{"norc and rcfile", shell.Config{NoRC: true, RCFile: home + "/custom.sh"}, true, "", ""},
+		{"rcfile", shell.Config{RCFile: home + "/custom.sh"}, true, "custom\n", ""},
+		{"missing rcfile", shell.Config{RCFile: home + "/nope"}, true, "", home + "/nope: No such file or directory\n"},
+		{"login", shell.Config{Login: true}, true, "profile\n", ""},
+		{"login script", shell.Config{Login: true}, false, "profile\n", ""},
+		{"posix", posix, true, "env\n", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out, errOut bytes.Buffer
+			cfg := tt.cfg
+			cfg.Stdout, cfg.Stderr = &out, &errOut
+			if cfg.Env == nil {
+				cfg.Env = []string{"HOME=" + home}
+			}
+			sh := shell.New(cfg)
+			if err := sh.RunStartup(context.Background(), tt.interactive); err != nil {
+				t.Fatal(err)
+			}
+			sh.Eval(context.Background(), "ll 2>/dev/null")
+			if out.String() != tt.out {
+				t.Errorf("stdout: got %q, want %q", out.String(), tt.out)
+			}
+			if errOut.String() != tt.errOut {
+				t.Errorf("stderr: got %q, want %q", errOut.String(), tt.errOut)
+			}
+		})
+	}
+}
+
+func TestDir(t *testing.T) {
+	root := t.TempDir()
+	for _, d := range []string{"a", "b", "a/sub"} {
+		if err := os.Mkdir(root+"/"+d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cwd, _ := os.Getwd()
+
+	run := func(dir, src string) string {
+		var out bytes.Buffer
+		sh := shell.New(shell.Config{Stdout: &out, Dir: dir})
+		if _, err := sh.Eval(context.Background(), src); err != nil {
+			t.Fatalf("%q: %v", src, err)
+		}
+		return out.String()
+	}
+
+	got := run(root+"/a", `pwd; /bin/pwd; echo x > f; cat < f
+(cd sub; pwd); pwd; cd sub | cat; pwd
+cd sub; echo $PWD $OLDPWD; cd ..; ls
+[ -f f ] && echo file; echo s*`)
+	want := strings.ReplaceAll(`R/a
+R/a
+x
+R/a/sub
+R/a
+R/a
+R/a/sub R/a
+f
+sub
+file
+sub
+`, "R", root)
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if got := run(root+"/b", "pwd"); got != root+"/b\n" {
+		t.Errorf("second shell: got %q", got)
+	}
+	if now, _ := os.Getwd(); now != cwd {
+		t.Errorf("the process moved from %s to %s", cwd, now)
+	}
+}
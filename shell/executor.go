@@ -0,0 +1,559 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/codecrafters-io/shell-starter-go/internal"
+)
+
+// statusError is returned by a command that failed with the given exit
+// status after reporting the problem itself.
+type statusError int
+
+func (e statusError) Error() string {
+	return fmt.Sprintf("exit status %d", int(e))
+}
+
+// signalError is returned for a process that was killed by a signal.
+type signalError syscall.Signal
+
+func (e signalError) Error() string {
+	return "signal: " + syscall.Signal(e).String()
+}
+
+// exitStatus converts the error of a finished command to its exit status.
+func exitStatus(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var status statusError
+	if errors.As(err, &status) {
+		return int(status)
+	}
+	if sig := exitSignal(err); sig != 0 {
+		return 128 + int(sig)
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+
+	return 1
+}
+
+// exitSignal returns the signal that ended the command of err, or 0 if it
+// exited by itself.
+func exitSignal(err error) syscall.Signal {
+	var sig signalError
+	if errors.As(err, &sig) {
+		return syscall.Signal(sig)
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+			return ws.Signal()
+		}
+	}
+	return 0
+}
+
+// isControlErr reports whether err unwinds the shell rather than being a
+// command failure.
+func isControlErr(err error) bool {
+	return errors.Is(err, ErrExit) || errors.Is(err, errReturn)
+}
+
+type ioFiles struct {
+	stdin  *os.File
+	stdout *os.File
+	stderr *os.File
+}
+
+func stdFiles() ioFiles {
+	return ioFiles{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr}
+}
+
+// process is a pipeline stage, either a *Command or a compound command
+// running in its own goroutine.
+type process interface {
+	Start() error
+	Wait() error
+}
+
+// runList runs every item of l and leaves the status of the last one in
+// sh.lastStatus. Only control errors such as ErrExit, and the error of the
+// shell's context once it is done, are returned.
+func (sh *Shell) runList(l *List, files ioFiles) error {
+	for _, item := range l.Items {
+		if err := sh.ctx.Err(); err != nil {
+			return err
+		}
+		if item.Async {
+			sh.startJob(item, files)
+		} else if err := sh.runAndOr(item, files); err != nil {
+			return err
+		}
+		if err := sh.runPendingTraps(files); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sh *Shell) runAndOr(a *AndOr, files ioFiles) error {
+	last := 0
+	for i, p := range a.Pipelines {
+		if i > 0 && (a.Ops[i-1] == TokenAnd) != (sh.lastStatus == 0) {
+			continue
+		}
+
+		// a failure is expected from a pipeline before && or || and from a
+		// negated one, errexit and the ERR trap leave them alone, including
+		// everything they run
+		checked := i < len(a.Pipelines)-1 || p.Negate
+		if checked {
+			sh.checking++
+		}
+		err := sh.runPipeline(p, files)
+		if checked {
+			sh.checking--
+		}
+		if err != nil {
+			return err
+		}
+		last = i
+	}
+
+	if sh.lastStatus == 0 || sh.checking > 0 || last < len(a.Pipelines)-1 || a.Pipelines[last].Negate {
+		return nil
+	}
+	if err := sh.runErrTrap(files); err != nil {
+		return err
+	}
+	if sh.opts.Get(OptErrexit) {
+		return ErrExit
+	}
+	return nil
+}
+
+func (sh *Shell) runPipeline(p *Pipeline, files ioFiles) error {
+	var err error
+	sh.lastSignal = 0
+
+	if len(sh.frames) == 0 {
+		if err := sh.runTrap("DEBUG", files); err != nil {
+			return err
+		}
+	}
+
+	if len(p.Cmds) == 1 {
+		if _, ok := p.Cmds[0].(*Command); !ok {
+			err = sh.runNode(p.Cmds[0], files)
+			if p.Negate {
+				sh.lastStatus = negate(sh.lastStatus)
+			}
+			return err
+		}
+	}
+
+	// with job control every foreground pipeline is a job of its own,
+	// pipelines started from inside it belong to the same job
+	var job *Job
+	if sh.jobControl && sh.job == nil {
+		var sb strings.Builder
+		formatPipeline(&sb, p, 0)
+		job = newJob(oneLine(sb.String()))
+		job.foreground = true
+		sh.job = job
+		defer func() { sh.job = nil }()
+	}
+
+	// Every stage of a longer pipeline runs in a subshell, except for the
+	// last one with lastpipe.
+	last := len(p.Cmds) - 1
+	inParent := len(p.Cmds) == 1 || sh.opts.Get(OptLastpipe)
+
+	stages := make([]*stage, len(p.Cmds))
+	for i := range stages {
+		st := &stage{sh: sh, files: files}
+		if i < last || !inParent {
+			st.sh = sh.subshell()
+		}
+		stages[i] = st
+	}
+	for i := 0; i < last; i++ {
+		pr, pw, err := os.Pipe()
+		if err != nil {
+			fmt.Fprintln(files.stderr, err)
+			for _, st := range stages {
+				st.release()
+			}
+			sh.lastStatus = 1
+			return nil
+		}
+		stages[i].files.stdout = pw
+		stages[i].pipes = append(stages[i].pipes, pw)
+		stages[i+1].files.stdin = pr
+		stages[i+1].pipes = append(stages[i+1].pipes, pr)
+	}
+	for i, n := range p.Cmds {
+		stages[i].proc = stages[i].sh.newProcess(n, stages[i].files, stages[i].release)
+	}
+
+	status := 0
+	started := len(stages)
+	var startErr error
+	for i := last; i >= 0; i-- {
+		err := stages[i].proc.Start()
+		if err != nil {
+			status = exitStatus(err)
+			// a command that cannot start can still end the shell, like
+			// an unbound variable does
+			if isControlErr(err) && stages[i].sh == sh {
+				startErr = err
+			}
+			break
+		}
+		started = i
+	}
+
+	// a stage that did not start counts with the status of the failure, a
+	// stage after it sees end of file
+	for _, st := range stages[:started] {
+		st.release()
+	}
+	// the processes of the pipeline are known now, a background job does
+	// not hold up the shell any longer
+	if sh.job != nil {
+		sh.job.markStarted()
+	}
+
+	wait := func(status int) (int, syscall.Signal, error) {
+		var (
+			ctrlErr   = startErr
+			sig       syscall.Signal
+			failedSig syscall.Signal
+		)
+		failed := status
+		for i := started; i < len(stages); i++ {
+			st := stages[i]
+			err := st.proc.Wait()
+			st.release()
+
+			if isControlErr(err) {
+				if st.sh == sh {
+					ctrlErr = err
+				} else if st.sh.lastStatus != 0 {
+					// exit or return only end the subshell
+					err = statusError(st.sh.lastStatus)
+				} else {
+					err = nil
+				}
+			}
+
+			// the status is the one of the last stage, or with pipefail
+			// the one of the last stage that failed
+			if code := exitStatus(err); code != 0 {
+				failed, failedSig = code, exitSignal(err)
+			}
+			if i == last {
+				status, sig = exitStatus(err), exitSignal(err)
+			}
+		}
+		if sh.opts.Get(OptPipefail) && failed != 0 {
+			status, sig = failed, failedSig
+		}
+		return status, sig, ctrlErr
+	}
+
+	var sig syscall.Signal
+	if job == nil {
+		status, sig, err = wait(status)
+		if err != nil {
+			return err
+		}
+	} else {
+		// the pipeline is waited for in the background so the shell can
+		// take over again when it stops
+		var waitErr error
+		go func(status int) {
+			var sig syscall.Signal
+			status, sig, waitErr = wait(status)
+			job.finish(status, sig)
+		}(status)
+
+		if sh.waitForeground(job) {
+			sh.suspendJob(job, files.stderr)
+			sh.lastStatus = 128 + int(syscall.SIGTSTP)
+			return nil
+		}
+		if waitErr != nil {
+			return waitErr
+		}
+		reportSignaled(job, files.stderr)
+		status = job.Status()
+		sig = job.Signal()
+	}
+
+	if p.Negate {
+		status, sig = negate(status), 0
+	}
+	sh.lastStatus, sh.lastSignal = status, sig
+	return nil
+}
+
+func negate(status int) int {
+	if status == 0 {
+		return 1
+	}
+	return 0
+}
+
+// stage is a command of a pipeline, with the shell it runs in and the pipe
+// ends that only it uses.
+type stage struct {
+	proc  process
+	sh    *Shell
+	files ioFiles
+	pipes []*os.File
+
+	once sync.Once
+}
+
+// release closes the pipe ends of the stage in the shell, so that the
+// stages on the other side see end of file or a broken pipe as soon as this
+// one is done.
+func (st *stage) release() {
+	st.once.Do(func() {
+		for _, f := range st.pipes {
+			f.Close()
+		}
+	})
+}
+
+func (sh *Shell) newProcess(n Node, files ioFiles, release func()) process {
+	if cmd, ok := n.(*Command); ok {
+		// the parsed command may run again, keep its runtime state apart
+		c := *cmd
+		c.sh = sh
+		c.Stdin = files.stdin
+		c.Stdout = files.stdout
+		c.Stderr = files.stderr
+		c.release = release
+		return &c
+	}
+	return &nodeProcess{sh: sh, node: n, files: files, release: release}
+}
+
+// nodeProcess runs a compound command as a pipeline stage.
+type nodeProcess struct {
+	sh      *Shell
+	node    Node
+	files   ioFiles
+	release func()
+
+	done chan error
+}
+
+func (np *nodeProcess) Start() error {
+	np.done = make(chan error, 1)
+	go func() {
+		defer func() {
+			if e := recover(); e != nil {
+				np.done <- fmt.Errorf("panic: %v", e)
+			}
+		}()
+
+		err := np.sh.runNode(np.node, np.files)
+		if err == nil && np.sh.lastStatus != 0 {
+			err = statusError(np.sh.lastStatus)
+		}
+		np.release()
+		np.done <- err
+	}()
+	return nil
+}
+
+func (np *nodeProcess) Wait() error {
+	return <-np.done
+}
+
+func (sh *Shell) runNode(n Node, files ioFiles) error {
+	switch n := n.(type) {
+	case *List:
+		return sh.runList(n, files)
+	case *AndOr:
+		return sh.runAndOr(n, files)
+	case *Pipeline:
+		return sh.runPipeline(n, files)
+	case *Command:
+		return sh.runPipeline(&Pipeline{Cmds: []Node{n}}, files)
+	case *CaseClause:
+		return sh.runCase(n, files)
+	case *FuncDef:
+		sh.defineFunction(n)
+		return nil
+	case *Subshell:
+		return sh.runSubshell(n, files)
+	case *BraceGroup:
+		return sh.runGroup(n, files)
+	case *CondCommand:
+		return sh.runCond(n, files)
+	}
+	return fmt.Errorf("unknown node %T", n)
+}
+
+func (sh *Shell) runGroup(g *BraceGroup, files ioFiles) error {
+	files, closeFiles, err := sh.openRedirects(&g.Redirects, files)
+	if err != nil {
+		fmt.Fprintln(files.stderr, err)
+		return sh.expansionError(err)
+	}
+	defer closeFiles()
+
+	return sh.runList(g.Body, files)
+}
+
+// runSubshell runs the body on a copy of the shell, so variables, functions
+// and options set inside do not leak out and `exit` only ends the copy.
+// The copy has its own dir, a cd inside does not move the shell.
+func (sh *Shell) runSubshell(s *Subshell, files ioFiles) error {
+	files, closeFiles, err := sh.openRedirects(&s.Redirects, files)
+	if err != nil {
+		fmt.Fprintln(files.stderr, err)
+		return sh.expansionError(err)
+	}
+	defer closeFiles()
+
+	sub := sh.subshell()
+	err = sub.runList(s.Body, files)
+	sub.runExitTrap(files)
+	if err != nil && !isControlErr(err) {
+		return err
+	}
+	sh.lastStatus = sub.lastStatus
+	return nil
+}
+
+// openRedirects applies the redirections of a compound command on top of
+// files, the returned function closes whatever was opened.
+func (sh *Shell) openRedirects(r *Redirects, files ioFiles) (ioFiles, func(), error) {
+	redirects := *r
+	if err := redirects.expandRedirects(sh); err != nil {
+		return files, func() {}, err
+	}
+	return sh.applyRedirects(redirects, files)
+}
+
+// applyRedirects opens the files of expanded redirections and puts them in
+// place of the ones in files.
+func (sh *Shell) applyRedirects(r Redirects, files ioFiles) (ioFiles, func(), error) {
+	var opened []*os.File
+	closeFiles := func() {
+		for _, f := range opened {
+			f.Close()
+		}
+	}
+
+	for _, rd := range []Redirect{r.RedirectIn, r.RedirectOutput, r.RedirectErr} {
+		if rd.TokenType == 0 {
+			continue
+		}
+		f, err := sh.openRedirect(rd)
+		if err != nil {
+			closeFiles()
+			var pathErr *os.PathError
+			if errors.As(err, &pathErr) {
+				err = pathErr.Err
+			}
+			return files, func() {}, fmt.Errorf("%s: %v", rd.FileName, err)
+		}
+		opened = append(opened, f)
+
+		switch rd.TokenType {
+		case TokenRedirectIn:
+			files.stdin = f
+		case TokenRedirectOut, TokenRedirectOutAppend:
+			files.stdout = f
+		case TokenRedirectErr, TokenRedirectErrAppend:
+			files.stderr = f
+		}
+	}
+	return files, closeFiles, nil
+}
+
+func (sh *Shell) runCase(c *CaseClause, files ioFiles) error {
+	word, err := sh.expandWord(c.Word)
+	if err != nil {
+		fmt.Fprintln(files.stderr, err)
+		return sh.expansionError(err)
+	}
+
+	sh.lastStatus = 0
+	fall := false
+	for _, item := range c.Items {
+		if !fall {
+			ok, err := sh.caseMatch(word, item.Patterns)
+			if err != nil {
+				fmt.Fprintln(files.stderr, err)
+				return sh.expansionError(err)
+			}
+			if !ok {
+				continue
+			}
+		}
+
+		if err := sh.runList(item.Body, files); err != nil {
+			return err
+		}
+
+		switch item.Term {
+		case TokenSemiAnd:
+			fall = true
+		case TokenDSemiAnd:
+			fall = false
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+func (sh *Shell) caseMatch(word string, patterns []Token) (bool, error) {
+	fold := sh.opts.Get(OptNocasematch)
+	for _, p := range patterns {
+		pattern, err := sh.expandPattern(p)
+		if err != nil {
+			return false, err
+		}
+		if internal.Match(pattern, word, fold) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
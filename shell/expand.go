@@ -0,0 +1,705 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/shell-starter-go/internal"
+)
+
+// field is one word being built by the expander. val is the plain text, pat
+// is the same text with quoted glob characters escaped so it can be handed
+// to the glob matcher, and re has the quoted parts escaped for a regexp.
+type field struct {
+	val  strings.Builder
+	pat  strings.Builder
+	re   strings.Builder
+	meta bool
+}
+
+type wordExpander struct {
+	sh *Shell
+
+	// split enables field splitting of unquoted expansions.
+	split bool
+	// assign enables tilde expansion after `=` and `:`.
+	assign bool
+
+	fields []*field
+	cur    *field
+
+	// emptyMulti is set when the last expansion was a quoted "$@" or
+	// "${a[@]}" with nothing in it.
+	emptyMulti bool
+}
+
+// expandWords performs parameter expansion, field splitting and pathname
+// expansion on the command words and returns the resulting arguments.
+func (sh *Shell) expandWords(words []Token) ([]string, error) {
+	var args []string
+	for _, w := range words {
+		ex := &wordExpander{sh: sh, split: true}
+		if err := ex.expand(w.Raw); err != nil {
+			return nil, err
+		}
+		ex.endField()
+
+		for _, f := range ex.fields {
+			if f.meta && !sh.opts.Get(OptNoglob) {
+				matches := internal.Glob(sh.dir, f.pat.String())
+				if len(matches) > 0 {
+					args = append(args, matches...)
+					continue
+				}
+			}
+			args = append(args, f.val.String())
+		}
+	}
+	return args, nil
+}
+
+// expandWord expands w into a single string without field splitting or
+// pathname expansion, as done for assignments, redirection targets and the
+// case subject.
+func (sh *Shell) expandWord(w Token) (string, error) {
+	f, err := sh.expandSingle(w.Raw, false)
+	if err != nil {
+		return "", err
+	}
+	return f.val.String(), nil
+}
+
+// expandAssign expands the value part of a NAME=value word.
+func (sh *Shell) expandAssign(raw string) (string, error) {
+	ex := &wordExpander{sh: sh, assign: true}
+	if err := ex.expand(raw); err != nil {
+		return "", err
+	}
+	if ex.cur == nil {
+		return "", nil
+	}
+	return ex.cur.val.String(), nil
+}
+
+// expandPattern expands w into a glob pattern in which the quoted parts
+// only match themselves.
+func (sh *Shell) expandPattern(w Token) (string, error) {
+	f, err := sh.expandSingle(w.Raw, false)
+	if err != nil {
+		return "", err
+	}
+	return f.pat.String(), nil
+}
+
+func (sh *Shell) expandSingle(raw string, assign bool) (*field, error) {
+	ex := &wordExpander{sh: sh, assign: assign}
+	if err := ex.expand(raw); err != nil {
+		return nil, err
+	}
+	if ex.cur == nil {
+		return &field{}, nil
+	}
+	return ex.cur, nil
+}
+
+func (ex *wordExpander) field() *field {
+	if ex.cur == nil {
+		ex.cur = &field{}
+	}
+	return ex.cur
+}
+
+func (ex *wordExpander) endField() {
+	if ex.cur != nil {
+		ex.fields = append(ex.fields, ex.cur)
+		ex.cur = nil
+	}
+}
+
+func (ex *wordExpander) literal(s string, quoted bool) {
+	f := ex.field()
+	f.val.WriteString(s)
+	if quoted {
+		f.pat.WriteString(internal.QuoteMeta(s))
+		f.re.WriteString(regexp.QuoteMeta(s))
+		return
+	}
+	f.pat.WriteString(s)
+	f.re.WriteString(s)
+	if internal.HasMeta(s) {
+		f.meta = true
+	}
+}
+
+// result adds the value of an expansion, splitting it on IFS when it is
+// unquoted and field splitting is enabled.
+func (ex *wordExpander) result(s string, quoted bool) {
+	if quoted || !ex.split {
+		if s != "" || quoted {
+			ex.literal(s, quoted)
+		}
+		return
+	}
+
+	ifs, ok := ex.sh.getVar("IFS")
+	if !ok {
+		ifs = " \t\n"
+	}
+	if ifs == "" {
+		if s != "" {
+			ex.literal(s, false)
+		}
+		return
+	}
+
+	for _, c := range s {
+		if !strings.ContainsRune(ifs, c) {
+			ex.literal(string(c), false)
+			continue
+		}
+		if c == ' ' || c == '\t' || c == '\n' {
+			ex.endField()
+			continue
+		}
+		ex.field()
+		ex.endField()
+	}
+}
+
+func (ex *wordExpander) expand(raw string) error {
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		switch {
+		case c == '~' && (i == 0 || (ex.assign && (raw[i-1] == '=' || raw[i-1] == ':'))):
+			n := ex.tilde(raw[i:])
+			i += n - 1
+		case c == '\\':
+			if i+1 < len(raw) {
+				i++
+				if raw[i] != '\n' {
+					ex.literal(raw[i:i+1], true)
+				}
+			}
+		case c == '\'':
+			end := strings.IndexByte(raw[i+1:], '\'')
+			if end < 0 {
+				end = len(raw) - i - 1
+			}
+			ex.literal(raw[i+1:i+1+end], true)
+			i += end + 1
+		case c == '"':
+			n, err := ex.doubleQuoted(raw[i+1:])
+			if err != nil {
+				return err
+			}
+			i += n + 1
+		case c == '$':
+			n, err := ex.dollar(raw[i:], false)
+			if err != nil {
+				return err
+			}
+			i += n - 1
+		default:
+			ex.literal(raw[i:i+1], false)
+		}
+	}
+	return nil
+}
+
+// doubleQuoted expands the text after an opening `"` and returns the number
+// of bytes consumed, excluding the closing quote.
+func (ex *wordExpander) doubleQuoted(raw string) (int, error) {
+	hadField := ex.cur != nil
+	ex.field()
+
+	other := false
+	ex.emptyMulti = false
+
+	i := 0
+	for ; i < len(raw) && raw[i] != '"'; i++ {
+		if raw[i] != '$' {
+			other = true
+		}
+		switch raw[i] {
+		case '\\':
+			if i+1 < len(raw) && strings.IndexByte("$`\"\\\n", raw[i+1]) >= 0 {
+				i++
+				if raw[i] != '\n' {
+					ex.literal(raw[i:i+1], true)
+				}
+				continue
+			}
+			ex.literal(`\`, true)
+		case '$':
+			n, err := ex.dollar(raw[i:], true)
+			if err != nil {
+				return 0, err
+			}
+			if !ex.emptyMulti {
+				other = true
+			}
+			i += n - 1
+		default:
+			ex.literal(raw[i:i+1], true)
+		}
+	}
+
+	// "$@" with no positional parameters expands to nothing at all
+	if !hadField && !other && ex.emptyMulti {
+		ex.cur = nil
+	}
+	return i, nil
+}
+
+// dollar expands the parameter at the start of raw and returns the number
+// of bytes consumed.
+func (ex *wordExpander) dollar(raw string, quoted bool) (int, error) {
+	ex.emptyMulti = false
+	if len(raw) < 2 {
+		ex.literal("$", quoted)
+		return 1, nil
+	}
+
+	c := raw[1]
+	switch {
+	case c == '{':
+		end := matchingBrace(raw, 2)
+		if end < 0 {
+			ex.literal(raw, quoted)
+			return len(raw), nil
+		}
+		if err := ex.braced(raw[2:end], quoted); err != nil {
+			return 0, err
+		}
+		return end + 1, nil
+	case c == '@' || c == '*':
+		ex.multi(ex.sh.positional(), c == '*', quoted)
+		return 2, nil
+	case isSpecialParam(c) || ('0' <= c && c <= '9'):
+		val, err := ex.sh.lookupParam(string(c))
+		if err != nil {
+			return 0, err
+		}
+		ex.result(val, quoted)
+		return 2, nil
+	case isNameChar(rune(c), true):
+		n := 2
+		for n < len(raw) && isNameChar(rune(raw[n]), false) {
+			n++
+		}
+		val, err := ex.sh.lookupParam(raw[1:n])
+		if err != nil {
+			return 0, err
+		}
+		ex.result(val, quoted)
+		return n, nil
+	}
+
+	ex.literal("$", quoted)
+	return 1, nil
+}
+
+// multi expands $@ and $* or the elements of an array, giving each value
+// its own field where the shell would.
+func (ex *wordExpander) multi(args []string, star, quoted bool) {
+	ex.emptyMulti = quoted && !star && len(args) == 0
+	if quoted && star {
+		sep := " "
+		if ifs, ok := ex.sh.getVar("IFS"); ok {
+			sep = ""
+			if ifs != "" {
+				sep = ifs[:1]
+			}
+		}
+		ex.result(strings.Join(args, sep), true)
+		return
+	}
+
+	for i, arg := range args {
+		if i > 0 {
+			if quoted || ex.split {
+				ex.endField()
+			} else {
+				ex.literal(" ", false)
+			}
+		}
+		ex.result(arg, quoted)
+	}
+}
+
+// braced expands the inside of ${...}.
+func (ex *wordExpander) braced(inner string, quoted bool) error {
+	if len(inner) > 1 && inner[0] == '#' {
+		name := inner[1:]
+		if name == "@" || name == "*" {
+			ex.result(strconv.Itoa(len(ex.sh.positional())), quoted)
+			return nil
+		}
+		if base, sub, ok := cutSubscript(name); ok {
+			if sub == "@" || sub == "*" {
+				ex.result(strconv.Itoa(len(ex.sh.getArray(base))), quoted)
+				return nil
+			}
+			val, err := ex.sh.arrayElement(base, sub)
+			if err != nil {
+				return err
+			}
+			ex.result(strconv.Itoa(len([]rune(val))), quoted)
+			return nil
+		}
+		val, err := ex.sh.lookupParam(name)
+		if err != nil {
+			return err
+		}
+		ex.result(strconv.Itoa(len([]rune(val))), quoted)
+		return nil
+	}
+
+	n := paramNameLen(inner)
+	if n == 0 {
+		return fmt.Errorf("${%s}: bad substitution", inner)
+	}
+	name, rest := inner[:n], inner[n:]
+
+	if base, sub, ok := cutSubscript(inner); ok {
+		if sub == "@" || sub == "*" {
+			ex.multi(ex.sh.getArray(base), sub == "*", quoted)
+			return nil
+		}
+		val, err := ex.sh.arrayElement(base, sub)
+		if err != nil {
+			return err
+		}
+		ex.result(val, quoted)
+		return nil
+	}
+
+	if rest == "" {
+		if name == "@" || name == "*" {
+			ex.multi(ex.sh.positional(), name == "*", quoted)
+			return nil
+		}
+		val, err := ex.sh.lookupParam(name)
+		if err != nil {
+			return err
+		}
+		ex.result(val, quoted)
+		return nil
+	}
+
+	val, set := ex.sh.getParam(name)
+
+	colon := rest[0] == ':'
+	if colon {
+		rest = rest[1:]
+	}
+	if rest == "" {
+		return fmt.Errorf("${%s}: bad substitution", inner)
+	}
+	op, word := rest[0], rest[1:]
+	useWord := !set || (colon && val == "")
+
+	switch op {
+	case '-':
+		if useWord {
+			return ex.subWord(word, quoted)
+		}
+		ex.result(val, quoted)
+	case '=':
+		if useWord {
+			w, err := ex.sh.expandSingle(word, false)
+			if err != nil {
+				return err
+			}
+			val = w.val.String()
+			ex.sh.setVar(name, val)
+		}
+		ex.result(val, quoted)
+	case '+':
+		if !useWord {
+			return ex.subWord(word, quoted)
+		}
+	case '?':
+		if useWord {
+			msg := "parameter null or not set"
+			if word != "" {
+				w, err := ex.sh.expandSingle(word, false)
+				if err != nil {
+					return err
+				}
+				msg = w.val.String()
+			}
+			return fmt.Errorf("%s: %s", name, msg)
+		}
+		ex.result(val, quoted)
+	case '#', '%':
+		if colon {
+			return fmt.Errorf("${%s}: bad substitution", inner)
+		}
+		longest := len(word) > 0 && word[0] == op
+		if longest {
+			word = word[1:]
+		}
+		p, err := ex.sh.expandSingle(word, false)
+		if err != nil {
+			return err
+		}
+		ex.result(trimPattern(val, p.pat.String(), op == '#', longest), quoted)
+	default:
+		return fmt.Errorf("${%s}: bad substitution", inner)
+	}
+	return nil
+}
+
+// subWord expands the word of ${name-word} style operators in place, so
+// its quoting and splitting follow the surrounding context.
+func (ex *wordExpander) subWord(word string, quoted bool) error {
+	if !quoted {
+		return ex.expand(word)
+	}
+	w, err := ex.sh.expandSingle(word, false)
+	if err != nil {
+		return err
+	}
+	ex.result(w.val.String(), true)
+	return nil
+}
+
+// trimPattern removes the shortest or longest prefix or suffix of s that
+// matches pattern.
+func trimPattern(s, pattern string, prefix, longest bool) string {
+	r := []rune(s)
+	if prefix {
+		for i := range len(r) + 1 {
+			n := i
+			if longest {
+				n = len(r) - i
+			}
+			if internal.Match(pattern, string(r[:n]), false) {
+				return string(r[n:])
+			}
+		}
+		return s
+	}
+	for i := range len(r) + 1 {
+		n := len(r) - i
+		if longest {
+			n = i
+		}
+		if internal.Match(pattern, string(r[n:]), false) {
+			return string(r[:n])
+		}
+	}
+	return s
+}
+
+// tilde expands a leading ~ or ~user and returns the bytes consumed.
+func (ex *wordExpander) tilde(raw string) int {
+	end := strings.IndexAny(raw, "/:")
+	if end < 0 {
+		end = len(raw)
+	}
+	prefix := raw[1:end]
+	if strings.ContainsAny(prefix, "'\"\\$") {
+		ex.literal("~", false)
+		return 1
+	}
+
+	var dir string
+	if prefix == "" {
+		dir, _ = ex.sh.getVar("HOME")
+		if dir == "" {
+			dir, _ = os.UserHomeDir()
+		}
+	} else if d, ok := ex.sh.tildeStack(prefix); ok {
+		dir = d
+	} else if strings.ContainsAny(prefix[:1], "+-0123456789") {
+		ex.literal(raw[:end], false)
+		return end
+	} else {
+		u, err := user.Lookup(prefix)
+		if err != nil {
+			ex.literal(raw[:end], false)
+			return end
+		}
+		dir = u.HomeDir
+	}
+	ex.literal(dir, true)
+	return end
+}
+
+// matchingBrace returns the index of the `}` closing the ${ that ends at
+// start, skipping over nested expansions and quotes.
+func matchingBrace(raw string, start int) int {
+	depth := 1
+	for i := start; i < len(raw); i++ {
+		switch raw[i] {
+		case '\\':
+			i++
+		case '\'':
+			end := strings.IndexByte(raw[i+1:], '\'')
+			if end < 0 {
+				return -1
+			}
+			i += end + 1
+		case '{':
+			if i > 0 && raw[i-1] == '$' {
+				depth++
+			}
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// cutSubscript splits name[sub] into its parts.
+func cutSubscript(s string) (name, sub string, ok bool) {
+	open := strings.IndexByte(s, '[')
+	if open <= 0 || !strings.HasSuffix(s, "]") || !isName(s[:open]) {
+		return "", "", false
+	}
+	return s[:open], s[open+1 : len(s)-1], true
+}
+
+// arrayElement returns ${name[sub]}, the subscript is expanded first and
+// negative indexes count from the end.
+func (sh *Shell) arrayElement(name, sub string) (string, error) {
+	f, err := sh.expandSingle(sub, false)
+	if err != nil {
+		return "", err
+	}
+	idx, err := strconv.Atoi(strings.TrimSpace(f.val.String()))
+	if err != nil {
+		return "", fmt.Errorf("%s: bad array subscript", sub)
+	}
+	values := sh.getArray(name)
+	if idx < 0 {
+		idx += len(values)
+	}
+	if idx < 0 || idx >= len(values) {
+		return "", nil
+	}
+	return values[idx], nil
+}
+
+func isSpecialParam(c byte) bool {
+	return strings.IndexByte("?#$!-0", c) >= 0
+}
+
+// paramNameLen returns the length of the parameter name at the start of s.
+func paramNameLen(s string) int {
+	if s == "" {
+		return 0
+	}
+	if isSpecialParam(s[0]) || s[0] == '@' || s[0] == '*' {
+		return 1
+	}
+	n := 0
+	if '0' <= s[0] && s[0] <= '9' {
+		for n < len(s) && '0' <= s[n] && s[n] <= '9' {
+			n++
+		}
+		return n
+	}
+	for n < len(s) && isNameChar(rune(s[n]), n == 0) {
+		n++
+	}
+	return n
+}
+
+// getParam returns the value of a variable, positional or special
+// parameter and whether it is set.
+func (sh *Shell) getParam(name string) (string, bool) {
+	switch name {
+	case "?":
+		return strconv.Itoa(sh.lastStatus), true
+	case "$":
+		return strconv.Itoa(os.Getpid()), true
+	case "#":
+		return strconv.Itoa(len(sh.positional())), true
+	case "0":
+		return sh.name, true
+	case "-":
+		return sh.opts.Flags(), true
+	case "!":
+		if sh.jobs.lastPid == 0 {
+			return "", false
+		}
+		return strconv.Itoa(sh.jobs.lastPid), true
+	case "@", "*":
+		args := sh.positional()
+		return strings.Join(args, " "), len(args) > 0
+	case "LINENO":
+		return strconv.Itoa(sh.lineno), true
+	case "FUNCNAME":
+		if frame := sh.currentFrame(); frame != nil {
+			return frame.name, true
+		}
+		return "", false
+	}
+
+	if '0' <= name[0] && name[0] <= '9' {
+		n, err := strconv.Atoi(name)
+		if err != nil {
+			return "", false
+		}
+		args := sh.positional()
+		if n < 1 || n > len(args) {
+			return "", false
+		}
+		return args[n-1], true
+	}
+
+	return sh.getVar(name)
+}
+
+// errUnbound is the error for an unset parameter under nounset.
+var errUnbound = errors.New("unbound variable")
+
+// lookupParam is getParam for plain $name references, which are an error
+// for an unset parameter under nounset.
+func (sh *Shell) lookupParam(name string) (string, error) {
+	val, ok := sh.getParam(name)
+	if !ok && sh.opts.Get(OptNounset) && name != "@" && name != "*" {
+		return "", fmt.Errorf("%s: %w", name, errUnbound)
+	}
+	return val, nil
+}
+
+// expansionError sets the status after a failed expansion was reported. An
+// unbound variable under nounset ends a shell that is not interactive, the
+// error is ErrExit then.
+func (sh *Shell) expansionError(err error) error {
+	sh.lastStatus = 1
+	if errors.Is(err, errUnbound) && !sh.interactive {
+		return ErrExit
+	}
+	return nil
+}
+
+// setPositional replaces the positional parameters of the current function
+// call, or of the shell.
+func (sh *Shell) setPositional(args []string) {
+	args = append([]string(nil), args...)
+	if frame := sh.currentFrame(); frame != nil {
+		frame.args = args
+		return
+	}
+	sh.args = args
+}
+
+func (sh *Shell) positional() []string {
+	if frame := sh.currentFrame(); frame != nil {
+		return frame.args
+	}
+	return sh.args
+}
@@ -0,0 +1,168 @@
+package shell
+
+import (
+	"strings"
+)
+
+const formatIndent = "    "
+
+// formatFunction renders fn the way `type` prints a function body.
+func formatFunction(fn *FuncDef) string {
+	var sb strings.Builder
+	sb.WriteString(fn.Name)
+	sb.WriteString(" () \n")
+	formatNode(&sb, fn.Body, 0)
+	return sb.String()
+}
+
+// shellQuote quotes s so that the shell reads it back as one word.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func formatList(sb *strings.Builder, l *List, depth int) {
+	for i, item := range l.Items {
+		sb.WriteString(strings.Repeat(formatIndent, depth))
+		formatAndOr(sb, item, depth)
+		if item.Async {
+			sb.WriteString(" &")
+		} else if i < len(l.Items)-1 {
+			sb.WriteString(";")
+		}
+		sb.WriteString("\n")
+	}
+}
+
+func formatAndOr(sb *strings.Builder, a *AndOr, depth int) {
+	for i, p := range a.Pipelines {
+		if i > 0 {
+			if a.Ops[i-1] == TokenAnd {
+				sb.WriteString(" && ")
+			} else {
+				sb.WriteString(" || ")
+			}
+		}
+		formatPipeline(sb, p, depth)
+	}
+}
+
+func formatPipeline(sb *strings.Builder, p *Pipeline, depth int) {
+	if p.Negate {
+		sb.WriteString("! ")
+	}
+	for i, n := range p.Cmds {
+		if i > 0 {
+			sb.WriteString(" | ")
+		}
+		formatNode(sb, n, depth)
+	}
+}
+
+func formatNode(sb *strings.Builder, n Node, depth int) {
+	indent := strings.Repeat(formatIndent, depth)
+
+	switch n := n.(type) {
+	case *Command:
+		var parts []string
+		for _, w := range n.Assigns {
+			parts = append(parts, w.Raw)
+		}
+		for _, w := range n.Words {
+			parts = append(parts, w.Raw)
+		}
+		sb.WriteString(strings.Join(parts, " "))
+		formatRedirects(sb, &n.Redirects)
+	case *CaseClause:
+		sb.WriteString("case " + n.Word.Raw + " in \n")
+		for _, item := range n.Items {
+			var patterns []string
+			for _, p := range item.Patterns {
+				patterns = append(patterns, p.Raw)
+			}
+			sb.WriteString(indent + formatIndent + strings.Join(patterns, " | ") + ")\n")
+			formatList(sb, item.Body, depth+2)
+			sb.WriteString(indent + formatIndent + caseTerm(item.Term) + "\n")
+		}
+		sb.WriteString(indent + "esac")
+	case *FuncDef:
+		sb.WriteString(n.Name + " () \n" + indent)
+		formatNode(sb, n.Body, depth)
+	case *BraceGroup:
+		sb.WriteString("{ \n")
+		formatList(sb, n.Body, depth+1)
+		sb.WriteString(indent + "}")
+		formatRedirects(sb, &n.Redirects)
+	case *CondCommand:
+		sb.WriteString("[[ ")
+		formatCond(sb, n.Expr)
+		sb.WriteString(" ]]")
+	case *Subshell:
+		sb.WriteString("( \n")
+		formatList(sb, n.Body, depth+1)
+		sb.WriteString(indent + ")")
+		formatRedirects(sb, &n.Redirects)
+	}
+}
+
+func formatCond(sb *strings.Builder, e *CondExpr) {
+	switch e.Op {
+	case "&&", "||":
+		formatCond(sb, e.X)
+		sb.WriteString(" " + e.Op + " ")
+		formatCond(sb, e.Y)
+	case "!":
+		sb.WriteString("! ")
+		formatCond(sb, e.X)
+	case "(":
+		sb.WriteString("( ")
+		formatCond(sb, e.X)
+		sb.WriteString(" )")
+	case "":
+		sb.WriteString(e.Words[0].Raw)
+	default:
+		if len(e.Words) == 1 {
+			sb.WriteString(e.Op + " " + e.Words[0].Raw)
+		} else {
+			sb.WriteString(e.Words[0].Raw + " " + e.Op + " " + e.Words[1].Raw)
+		}
+	}
+}
+
+func formatRedirects(sb *strings.Builder, r *Redirects) {
+	for _, rd := range []Redirect{r.RedirectIn, r.RedirectOutput, r.RedirectErr} {
+		if rd.TokenType == 0 {
+			continue
+		}
+		op := redirectOp(rd.TokenType)
+		if rd.Force {
+			op += "|"
+		}
+		sb.WriteString(" " + op + " " + rd.Target.Raw)
+	}
+}
+
+func redirectOp(t TokenType) string {
+	switch t {
+	case TokenRedirectOut:
+		return ">"
+	case TokenRedirectOutAppend:
+		return ">>"
+	case TokenRedirectErr:
+		return "2>"
+	case TokenRedirectErrAppend:
+		return "2>>"
+	case TokenRedirectIn:
+		return "<"
+	}
+	return ""
+}
+
+func caseTerm(t TokenType) string {
+	switch t {
+	case TokenSemiAnd:
+		return ";&"
+	case TokenDSemiAnd:
+		return ";;&"
+	}
+	return ";;"
+}
@@ -0,0 +1,185 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// defaultFuncNest bounds recursion when FUNCNEST is not set, deep
+	// enough for real scripts but well short of exhausting the Go stack.
+	defaultFuncNest = 1000
+)
+
+var (
+	errReturn = errors.New("return")
+)
+
+// callFrame is pushed for every function call. saved keeps the values that
+// `local` shadowed so they can be put back when the call returns.
+type callFrame struct {
+	name  string
+	args  []string
+	saved map[string]*Variable
+}
+
+func (sh *Shell) currentFrame() *callFrame {
+	if len(sh.frames) == 0 {
+		return nil
+	}
+	return sh.frames[len(sh.frames)-1]
+}
+
+func (sh *Shell) defineFunction(def *FuncDef) {
+	sh.funcs[def.Name] = def
+	sh.lastStatus = 0
+}
+
+func (sh *Shell) funcNest() int {
+	val, ok := sh.getVar("FUNCNEST")
+	if !ok {
+		return defaultFuncNest
+	}
+	n, err := strconv.Atoi(val)
+	if err != nil || n <= 0 {
+		return defaultFuncNest
+	}
+	return n
+}
+
+// callFunction runs fn with args as its positional parameters and leaves
+// its status in sh.lastStatus.
+func (sh *Shell) callFunction(fn *FuncDef, args []string, files ioFiles) error {
+	if limit := sh.funcNest(); len(sh.frames) >= limit {
+		fmt.Fprintf(files.stderr, "%s: maximum function nesting level exceeded (%d)\n", fn.Name, limit)
+		sh.lastStatus = 1
+		return nil
+	}
+
+	frame := &callFrame{
+		name:  fn.Name,
+		args:  args,
+		saved: make(map[string]*Variable),
+	}
+	sh.frames = append(sh.frames, frame)
+	defer sh.popFrame()
+
+	err := sh.runNode(fn.Body, files)
+	if errors.Is(err, errReturn) {
+		err = nil
+	}
+	if err == nil {
+		err = sh.runTrap("RETURN", files)
+	}
+	return err
+}
+
+func (sh *Shell) popFrame() {
+	frame := sh.currentFrame()
+	sh.frames = sh.frames[:len(sh.frames)-1]
+
+	for name, v := range frame.saved {
+		if v == nil {
+			sh.unsetVar(name)
+		} else {
+			sh.vars[name] = v
+		}
+	}
+}
+
+// declareLocal gives name a new value that lives until the current
+// function returns.
+func (sh *Shell) declareLocal(name string, value string, hasValue bool) {
+	frame := sh.currentFrame()
+	if _, ok := frame.saved[name]; !ok {
+		if v, ok := sh.vars[name]; ok {
+			old := *v
+			frame.saved[name] = &old
+		} else {
+			frame.saved[name] = nil
+		}
+	}
+
+	if !hasValue {
+		value = ""
+	}
+	sh.vars[name] = &Variable{Value: value}
+}
+
+func (c *Command) startFunction(fn *FuncDef) error {
+	return c.startInternal(func() error {
+		err := c.sh.callFunction(fn, c.Args[1:], c.files)
+		if err == nil && c.sh.lastStatus != 0 {
+			err = statusError(c.sh.lastStatus)
+		}
+		return err
+	})
+}
+
+func (c *Command) execLocal() error {
+	if c.sh.currentFrame() == nil {
+		fmt.Fprintf(c.stdio.Err, "local: can only be used in a function\n")
+		return statusError(1)
+	}
+
+	status := 0
+	for _, arg := range c.Args[1:] {
+		name, value, hasValue := cutAssignment(arg)
+		if name == "" {
+			fmt.Fprintf(c.stdio.Err, "local: `%s': not a valid identifier\n", arg)
+			status = 1
+			continue
+		}
+		c.sh.declareLocal(name, value, hasValue)
+	}
+	if status != 0 {
+		return statusError(status)
+	}
+	return nil
+}
+
+func (c *Command) execReturn() error {
+	if c.sh.currentFrame() == nil && c.sh.sourced == 0 {
+		fmt.Fprintf(c.stdio.Err, "return: can only `return' from a function or sourced script\n")
+		return statusError(1)
+	}
+
+	status := c.sh.lastStatus
+	if len(c.Args) >= 2 {
+		n, err := strconv.Atoi(c.Args[1])
+		if err != nil {
+			fmt.Fprintf(c.stdio.Err, "return: %s: numeric argument required\n", c.Args[1])
+			n = 2
+		}
+		status = n & 0xff
+	}
+	c.sh.lastStatus = status
+	return errReturn
+}
+
+// cutAssignment splits a NAME[=value] argument, name is empty if it is not
+// a valid identifier.
+func cutAssignment(arg string) (name, value string, hasValue bool) {
+	name, value, hasValue = arg, "", false
+	if i := strings.IndexByte(arg, '='); i >= 0 {
+		name, value, hasValue = arg[:i], arg[i+1:], true
+	}
+	if !isName(name) {
+		return "", "", false
+	}
+	return name, value, hasValue
+}
+
+func isName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		if !isNameChar(c, i == 0) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,698 @@
+package shell
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/chzyer/readline"
+)
+
+type JobState int
+
+const (
+	JobRunning JobState = iota + 1
+	JobStopped
+	JobDone
+)
+
+// Job is a pipeline or and-or list started with `&`, or one that was
+// stopped in the foreground.
+type Job struct {
+	ID  int
+	Cmd string
+
+	// pids holds the processes started by the job, pids[0] is reported as
+	// the job's PID.
+	pids []int
+
+	state  JobState
+	status int
+	// signal is set when the job was killed by a signal.
+	signal syscall.Signal
+
+	// pgid is the process group of the job when job control is on.
+	pgid       int
+	foreground bool
+	// term holds the terminal modes of a stopped job, they are put back
+	// when it is continued in the foreground.
+	term *readline.State
+
+	// reported is set once a stop was announced to the user.
+	reported bool
+
+	started chan struct{}
+	done    chan struct{}
+	// notify receives a value when the job stops.
+	notify chan struct{}
+
+	mu sync.Mutex
+}
+
+func newJob(cmd string) *Job {
+	return &Job{
+		Cmd:     cmd,
+		state:   JobRunning,
+		started: make(chan struct{}),
+		done:    make(chan struct{}),
+		notify:  make(chan struct{}, 1),
+	}
+}
+
+func (j *Job) addPid(pid int) {
+	j.mu.Lock()
+	j.pids = append(j.pids, pid)
+	j.mu.Unlock()
+
+	j.markStarted()
+}
+
+// markStarted lets startJob go on. It is called once the job started its
+// first process, or ran a command that needs none.
+func (j *Job) markStarted() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	select {
+	case <-j.started:
+	default:
+		close(j.started)
+	}
+}
+
+// Pid returns the PID reported for the job, 0 if no process was started.
+func (j *Job) Pid() int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if len(j.pids) == 0 {
+		return 0
+	}
+	return j.pids[0]
+}
+
+func (j *Job) Pgid() int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.pgid
+}
+
+func (j *Job) setPgid(pgid int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.pgid = pgid
+}
+
+func (j *Job) State() JobState {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.state
+}
+
+// Status returns the exit status of a finished job.
+func (j *Job) Status() int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.status
+}
+
+// Signal returns the signal that killed the job, or 0.
+func (j *Job) Signal() syscall.Signal {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.signal
+}
+
+// stop marks the job as stopped and wakes up whoever waits for it in the
+// foreground.
+func (j *Job) stop() {
+	j.mu.Lock()
+	j.state = JobStopped
+	j.reported = false
+	j.mu.Unlock()
+
+	select {
+	case j.notify <- struct{}{}:
+	default:
+	}
+}
+
+// resume marks a stopped job as running again and lets it continue.
+func (j *Job) resume() {
+	j.mu.Lock()
+	j.state = JobRunning
+	j.mu.Unlock()
+
+	select {
+	case <-j.notify:
+	default:
+	}
+	j.signalAll(syscall.SIGCONT)
+}
+
+func (j *Job) markReported() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.reported = true
+}
+
+// needsReport reports whether the job stopped without the user being told.
+func (j *Job) needsReport() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.state == JobStopped && !j.reported
+}
+
+// finish marks the job as done with its exit status, and the signal that
+// killed it if there was one.
+func (j *Job) finish(status int, sig syscall.Signal) {
+	j.mu.Lock()
+	j.state = JobDone
+	j.status = status
+	j.signal = sig
+	j.mu.Unlock()
+
+	j.markStarted()
+	close(j.done)
+}
+
+// signalAll sends sig to every process of the job, or to its process group
+// when it has one.
+func (j *Job) signalAll(sig syscall.Signal) {
+	j.mu.Lock()
+	pgid := j.pgid
+	pids := append([]int(nil), j.pids...)
+	j.mu.Unlock()
+
+	if pgid != 0 {
+		syscall.Kill(-pgid, sig)
+		return
+	}
+	for _, pid := range pids {
+		syscall.Kill(pid, sig)
+	}
+}
+
+// stateString renders the state column of `jobs`.
+func (j *Job) stateString() string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	switch j.state {
+	case JobRunning:
+		return "Running"
+	case JobStopped:
+		return "Stopped"
+	}
+	switch {
+	case j.signal != 0:
+		return signalDesc(j.signal)
+	case j.status != 0:
+		return fmt.Sprintf("Exit %d", j.status)
+	}
+	return "Done"
+}
+
+// signalDesc describes sig the way bash reports a job killed by it, like
+// `Killed` or `Segmentation fault`.
+func signalDesc(sig syscall.Signal) string {
+	desc := sig.String()
+	return strings.ToUpper(desc[:1]) + desc[1:]
+}
+
+// builtinPidBase is above the largest PID the kernel hands out, the PIDs
+// given to jobs without a process of their own count up from it.
+const builtinPidBase = 1 << 22
+
+// jobTable is the list of jobs of one shell. Subshells start with an empty
+// table of their own, only $! carries over.
+type jobTable struct {
+	jobs []*Job
+	// order holds job IDs from least to most recently used, the last two
+	// are the current (%+) and previous (%-) jobs.
+	order []int
+
+	lastPid int
+	// builtinPids counts the PIDs handed to jobs without a process.
+	builtinPids int
+	// reaped keeps the status of finished jobs by PID after they left the
+	// table, so `wait $!` still works once the job was reported.
+	reaped map[int]int
+
+	mu sync.Mutex
+}
+
+func (t *jobTable) add(j *Job) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	id := 1
+	for _, job := range t.jobs {
+		if job.ID >= id {
+			id = job.ID + 1
+		}
+	}
+	j.ID = id
+	t.jobs = append(t.jobs, j)
+	t.touch(j.ID)
+}
+
+// touch makes id the current job. The caller holds t.mu.
+func (t *jobTable) touch(id int) {
+	for i, o := range t.order {
+		if o == id {
+			t.order = append(t.order[:i], t.order[i+1:]...)
+			break
+		}
+	}
+	t.order = append(t.order, id)
+}
+
+// use makes j the current job.
+func (t *jobTable) use(j *Job) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.touch(j.ID)
+}
+
+func (t *jobTable) remove(j *Job) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	found := false
+	for i, job := range t.jobs {
+		if job == j {
+			t.jobs = append(t.jobs[:i], t.jobs[i+1:]...)
+			found = true
+			break
+		}
+	}
+	if found && j.State() == JobDone {
+		if t.reaped == nil {
+			t.reaped = make(map[int]int)
+		}
+		j.mu.Lock()
+		for _, pid := range j.pids {
+			t.reaped[pid] = j.status
+		}
+		j.mu.Unlock()
+	}
+	for i, o := range t.order {
+		if o == j.ID {
+			t.order = append(t.order[:i], t.order[i+1:]...)
+			break
+		}
+	}
+}
+
+func (t *jobTable) list() []*Job {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]*Job(nil), t.jobs...)
+}
+
+// marker returns "+" for the current job, "-" for the previous one.
+func (t *jobTable) marker(j *Job) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	n := len(t.order)
+	switch {
+	case n > 0 && t.order[n-1] == j.ID:
+		return "+"
+	case n > 1 && t.order[n-2] == j.ID:
+		return "-"
+	}
+	return " "
+}
+
+func (t *jobTable) byID(id int) *Job {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, j := range t.jobs {
+		if j.ID == id {
+			return j
+		}
+	}
+	return nil
+}
+
+func (t *jobTable) byPid(pid int) *Job {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i := len(t.jobs) - 1; i >= 0; i-- {
+		j := t.jobs[i]
+		j.mu.Lock()
+		found := false
+		for _, p := range j.pids {
+			if p == pid {
+				found = true
+				break
+			}
+		}
+		j.mu.Unlock()
+		if found {
+			return j
+		}
+	}
+	return nil
+}
+
+func (t *jobTable) reapedStatus(pid int) (int, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	status, ok := t.reaped[pid]
+	return status, ok
+}
+
+// lookup resolves a job spec: %n, %%, %+, %-, %prefix or %?substring. An
+// empty spec means the current job.
+func (t *jobTable) lookup(spec string) (*Job, error) {
+	if spec == "" {
+		spec = "%+"
+	}
+	if !strings.HasPrefix(spec, "%") {
+		return nil, fmt.Errorf("%s: no such job", spec)
+	}
+	s := spec[1:]
+
+	t.mu.Lock()
+	order := append([]int(nil), t.order...)
+	t.mu.Unlock()
+
+	switch {
+	case s == "" || s == "%" || s == "+":
+		if len(order) > 0 {
+			return t.byID(order[len(order)-1]), nil
+		}
+		return nil, fmt.Errorf("%s: no such job", "current")
+	case s == "-":
+		if len(order) > 1 {
+			return t.byID(order[len(order)-2]), nil
+		}
+		if len(order) > 0 {
+			return t.byID(order[len(order)-1]), nil
+		}
+		return nil, fmt.Errorf("%s: no such job", spec)
+	}
+
+	if n, err := strconv.Atoi(s); err == nil {
+		if j := t.byID(n); j != nil {
+			return j, nil
+		}
+		return nil, fmt.Errorf("%s: no such job", spec)
+	}
+
+	contains := strings.HasPrefix(s, "?")
+	if contains {
+		s = s[1:]
+	}
+	var found *Job
+	for _, j := range t.list() {
+		ok := strings.HasPrefix(j.Cmd, s)
+		if contains {
+			ok = strings.Contains(j.Cmd, s)
+		}
+		if !ok {
+			continue
+		}
+		if found != nil {
+			return nil, fmt.Errorf("%s: ambiguous job spec", spec)
+		}
+		found = j
+	}
+	if found == nil {
+		return nil, fmt.Errorf("%s: no such job", spec)
+	}
+	return found, nil
+}
+
+// startJob runs the and-or list in the background on a copy of the shell,
+// an interactive shell prints its job number and PID.
+func (sh *Shell) startJob(a *AndOr, files ioFiles) {
+	var sb strings.Builder
+	formatAndOr(&sb, a, 0)
+	job := newJob(oneLine(sb.String()))
+
+	sub := sh.subshell()
+	sub.job = job
+
+	// without job control a background job must not compete with the
+	// shell for the terminal
+	var devNull *os.File
+	if files.stdin == sh.files.stdin && !sh.jobControl {
+		if f, err := os.Open(os.DevNull); err == nil {
+			devNull = f
+			files.stdin = f
+		}
+	}
+
+	sh.jobs.add(job)
+
+	go func() {
+		if devNull != nil {
+			defer devNull.Close()
+		}
+
+		err := sub.runAndOr(a, files)
+		sig := sub.lastSignal
+		sub.runExitTrap(files)
+		status := sub.lastStatus
+		if err != nil && !isControlErr(err) {
+			status = 1
+		}
+		if status != 128+int(sig) {
+			// the list went on after the signal, or exit set the status
+			sig = 0
+		}
+		job.finish(status, sig)
+	}()
+
+	// a lone compound command runs right in the goroutine and may never
+	// start a process, the shell must not wait for it
+	first := a.Pipelines[0]
+	if _, ok := first.Cmds[0].(*Command); ok || len(first.Cmds) > 1 {
+		<-job.started
+	}
+	pid := job.Pid()
+	if pid == 0 {
+		// the job has no process of its own yet, it gets a PID that no
+		// process can have so that $! finds the job but kill $! cannot
+		// hit anything else
+		sh.jobs.builtinPids++
+		pid = builtinPidBase + sh.jobs.builtinPids
+		job.addPid(pid)
+	}
+	sh.jobs.lastPid = pid
+
+	// like bash, only an interactive shell announces the job
+	if sh.interactive {
+		fmt.Fprintf(files.stderr, "[%d] %d\n", job.ID, pid)
+	}
+	sh.lastStatus = 0
+}
+
+// oneLine folds a formatted command onto a single line for job listings.
+func oneLine(s string) string {
+	lines := strings.Split(s, "\n")
+	for i := range lines {
+		lines[i] = strings.TrimSpace(lines[i])
+	}
+	return strings.Join(lines, " ")
+}
+
+// reportJobs prints the jobs that finished or stopped since the last prompt,
+// finished ones are dropped from the table.
+func (sh *Shell) reportJobs(w io.Writer) {
+	for _, j := range sh.jobs.list() {
+		done := j.State() == JobDone
+		if !done && !j.needsReport() {
+			continue
+		}
+		fmt.Fprintf(w, "[%d]%s  %-24s%s\n", j.ID, sh.jobs.marker(j), j.stateString(), j.Cmd)
+		if done {
+			sh.jobs.remove(j)
+		} else {
+			j.markReported()
+		}
+	}
+}
+
+// waitJob blocks until j is done and returns its status.
+func (sh *Shell) waitJob(j *Job) int {
+	<-j.done
+	sh.jobs.remove(j)
+	return j.Status()
+}
+
+func (c *Command) execJobs() error {
+	var (
+		long     bool
+		pidsOnly bool
+		specs    []string
+	)
+	for _, arg := range c.Args[1:] {
+		switch {
+		case arg == "-l":
+			long = true
+		case arg == "-p":
+			pidsOnly = true
+		case strings.HasPrefix(arg, "-"):
+			fmt.Fprintf(c.stdio.Err, "jobs: %s: invalid option\n", arg)
+			return statusError(2)
+		default:
+			specs = append(specs, arg)
+		}
+	}
+
+	jobs := c.sh.jobs.list()
+	if len(specs) > 0 {
+		jobs = nil
+		for _, spec := range specs {
+			j, err := c.sh.jobs.lookup(spec)
+			if err != nil {
+				fmt.Fprintf(c.stdio.Err, "jobs: %s\n", err)
+				return statusError(1)
+			}
+			jobs = append(jobs, j)
+		}
+	}
+
+	for _, j := range jobs {
+		switch {
+		case pidsOnly:
+			fmt.Fprintf(c.stdio.Out, "%d\n", j.Pid())
+		case long:
+			fmt.Fprintf(c.stdio.Out, "[%d]%s %d %-24s%s%s\n", j.ID, c.sh.jobs.marker(j), j.Pid(), j.stateString(), j.Cmd, jobSuffix(j))
+		default:
+			fmt.Fprintf(c.stdio.Out, "[%d]%s  %-24s%s%s\n", j.ID, c.sh.jobs.marker(j), j.stateString(), j.Cmd, jobSuffix(j))
+		}
+		if j.State() == JobDone {
+			c.sh.jobs.remove(j)
+		}
+	}
+	return nil
+}
+
+func jobSuffix(j *Job) string {
+	if j.State() == JobRunning {
+		return " &"
+	}
+	return ""
+}
+
+func (c *Command) execFg() error {
+	spec := ""
+	if len(c.Args) >= 2 {
+		spec = c.Args[1]
+	}
+	j, err := c.sh.jobs.lookup(spec)
+	if err != nil {
+		fmt.Fprintf(c.stdio.Err, "fg: %s\n", err)
+		return statusError(1)
+	}
+
+	fmt.Fprintln(c.stdio.Out, j.Cmd)
+
+	if c.sh.jobControl {
+		j.foreground = true
+		if j.State() == JobStopped {
+			j.resume()
+		}
+		if c.sh.waitForeground(j) {
+			c.sh.suspendJob(j, c.stdio.Err)
+			return statusError(128 + int(syscall.SIGTSTP))
+		}
+		reportSignaled(j, c.stdio.Err)
+	} else if j.State() == JobStopped {
+		j.resume()
+	}
+
+	status := c.sh.waitJob(j)
+	if status != 0 {
+		return statusError(status)
+	}
+	return nil
+}
+
+func (c *Command) execBg() error {
+	specs := c.Args[1:]
+	if len(specs) == 0 {
+		specs = []string{""}
+	}
+
+	status := 0
+	for _, spec := range specs {
+		j, err := c.sh.jobs.lookup(spec)
+		if err != nil {
+			fmt.Fprintf(c.stdio.Err, "bg: %s\n", err)
+			status = 1
+			continue
+		}
+		if j.State() != JobStopped {
+			fmt.Fprintf(c.stdio.Err, "bg: job %d already in background\n", j.ID)
+			continue
+		}
+		j.resume()
+		c.sh.jobs.use(j)
+		fmt.Fprintf(c.stdio.Out, "[%d]%s %s &\n", j.ID, c.sh.jobs.marker(j), j.Cmd)
+	}
+	if status != 0 {
+		return statusError(status)
+	}
+	return nil
+}
+
+// execWait waits for the given jobs or PIDs, or for every job when called
+// without arguments, and returns the status of the last one.
+func (c *Command) execWait() error {
+	if len(c.Args) < 2 {
+		for _, j := range c.sh.jobs.list() {
+			c.sh.waitJob(j)
+		}
+		return nil
+	}
+
+	status := 0
+	for _, arg := range c.Args[1:] {
+		var j *Job
+		if strings.HasPrefix(arg, "%") {
+			var err error
+			j, err = c.sh.jobs.lookup(arg)
+			if err != nil {
+				fmt.Fprintf(c.stdio.Err, "wait: %s\n", err)
+				status = 127
+				continue
+			}
+		} else {
+			pid, err := strconv.Atoi(arg)
+			if err != nil {
+				fmt.Fprintf(c.stdio.Err, "wait: `%s': not a pid or valid job spec\n", arg)
+				status = 2
+				continue
+			}
+			j = c.sh.jobs.byPid(pid)
+			if j == nil {
+				if st, ok := c.sh.jobs.reapedStatus(pid); ok {
+					status = st
+					continue
+				}
+				fmt.Fprintf(c.stdio.Err, "wait: pid %d is not a child of this shell\n", pid)
+				status = 127
+				continue
+			}
+		}
+		status = c.sh.waitJob(j)
+	}
+	if status != 0 {
+		return statusError(status)
+	}
+	return nil
+}
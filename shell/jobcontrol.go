@@ -0,0 +1,203 @@
+package shell
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/chzyer/readline"
+)
+
+// initJobControl turns job control on when the shell reads commands from a
+// terminal: the shell becomes a process group of its own and takes the
+// terminal.
+func (sh *Shell) initJobControl() {
+	fd := int(os.Stdin.Fd())
+	if !readline.IsTerminal(fd) {
+		return
+	}
+
+	// The shell hands the terminal back and forth while it is not the
+	// foreground group itself, which would otherwise stop it. Children start
+	// their own group with the terminal from the forked process, they need
+	// this too.
+	signal.Ignore(syscall.SIGTTOU)
+
+	// The keyboard signals must not end or stop the shell. They are caught
+	// rather than ignored, so that commands start with the default action.
+	// Without a trap they are dropped by runPendingTraps.
+	signal.Notify(sh.signals, keyboardSignals...)
+
+	// fails for a session leader, which already is its own group
+	_ = syscall.Setpgid(0, 0)
+	pgid := syscall.Getpgrp()
+	if err := tcsetpgrp(fd, pgid); err != nil {
+		return
+	}
+
+	sh.jobControl = true
+	sh.tty = fd
+	sh.pgid = pgid
+	sh.term, _ = readline.GetState(fd)
+}
+
+// jobProcAttr puts a new process of the current job into the job's process
+// group. A foreground job also gets the terminal.
+func (sh *Shell) jobProcAttr(j *Job) *syscall.SysProcAttr {
+	pgid := j.Pgid()
+	if pgid != 0 && syscall.Kill(-pgid, 0) != nil {
+		// every process of the group is gone, the next one leads a new group
+		pgid = 0
+	}
+	return &syscall.SysProcAttr{
+		Setpgid:    true,
+		Pgid:       pgid,
+		Foreground: j.foreground,
+		Ctty:       sh.tty,
+	}
+}
+
+// waitForeground gives the terminal to j and waits until it is done or
+// stopped, then takes the terminal back. It reports whether j stopped.
+func (sh *Shell) waitForeground(j *Job) bool {
+	if pgid := j.Pgid(); pgid != 0 {
+		_ = tcsetpgrp(sh.tty, pgid)
+		if j.term != nil {
+			_ = readline.Restore(sh.tty, j.term)
+		}
+	}
+
+	stopped := false
+	select {
+	case <-j.done:
+	case <-j.notify:
+		select {
+		case <-j.done:
+		default:
+			stopped = true
+		}
+	}
+
+	if stopped {
+		j.term, _ = readline.GetState(sh.tty)
+	}
+	_ = tcsetpgrp(sh.tty, sh.pgid)
+	if sh.term != nil {
+		_ = readline.Restore(sh.tty, sh.term)
+	}
+	return stopped
+}
+
+// suspendJob puts a foreground job that was stopped into the job table and
+// tells the user.
+func (sh *Shell) suspendJob(j *Job, w io.Writer) {
+	if j.ID == 0 {
+		sh.jobs.add(j)
+	} else {
+		sh.jobs.use(j)
+	}
+	j.foreground = false
+	j.markReported()
+
+	fmt.Fprintf(w, "\n[%d]%s  %-24s%s\n", j.ID, sh.jobs.marker(j), j.stateString(), j.Cmd)
+}
+
+// reportSignaled tells the user about a foreground job that was killed by
+// a signal, like `Killed` or `Quit`. An interrupt only ends the line.
+func reportSignaled(j *Job, w io.Writer) {
+	j.mu.Lock()
+	sig := j.signal
+	j.mu.Unlock()
+
+	switch sig {
+	case 0, syscall.SIGPIPE:
+	case syscall.SIGINT:
+		fmt.Fprintln(w)
+	default:
+		fmt.Fprintln(w, signalDesc(sig))
+	}
+}
+
+// waitProcess waits for p to exit like exec.Cmd.Wait, it also notices when
+// p is stopped and marks j as stopped. The wait goes on until p exits.
+func waitProcess(p *os.Process, j *Job) error {
+	defer p.Release()
+
+	for {
+		var ws syscall.WaitStatus
+		_, err := syscall.Wait4(p.Pid, &ws, syscall.WUNTRACED, nil)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case ws.Stopped():
+			j.stop()
+		case ws.Signaled():
+			return signalError(ws.Signal())
+		case ws.ExitStatus() != 0:
+			return statusError(ws.ExitStatus())
+		default:
+			return nil
+		}
+	}
+}
+
+func tcsetpgrp(fd, pgid int) error {
+	p := int32(pgid)
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), uintptr(syscall.TIOCSPGRP), uintptr(unsafe.Pointer(&p)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func tcgetattr(fd int) (*syscall.Termios, error) {
+	var t syscall.Termios
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), uintptr(ioctlGetTermios), uintptr(unsafe.Pointer(&t)))
+	if errno != 0 {
+		return nil, errno
+	}
+	return &t, nil
+}
+
+func tcsetattr(fd int, t *syscall.Termios) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), uintptr(ioctlSetTermios), uintptr(unsafe.Pointer(t)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// pollFd is struct pollfd of poll(2).
+type pollFd struct {
+	fd      int32
+	events  int16
+	revents int16
+}
+
+const pollIn = 0x1
+
+// waitReadable waits until fd has input or the timeout passes, and reports
+// which happened first.
+func waitReadable(fd int, timeout time.Duration) (bool, error) {
+	deadline := time.Now().Add(max(timeout, 0))
+	for {
+		p := pollFd{fd: int32(fd), events: pollIn}
+		n, errno := poll(&p, max(time.Until(deadline), 0))
+		if errno == syscall.EINTR {
+			continue
+		}
+		if errno != 0 {
+			return false, errno
+		}
+		return n > 0, nil
+	}
+}
@@ -0,0 +1,20 @@
+package shell
+
+import (
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	ioctlGetTermios = syscall.TCGETS
+	ioctlSetTermios = syscall.TCSETS
+)
+
+// poll waits for the descriptor of p with ppoll(2), as some architectures
+// have no poll(2).
+func poll(p *pollFd, timeout time.Duration) (int, syscall.Errno) {
+	ts := syscall.NsecToTimespec(timeout.Nanoseconds())
+	n, _, errno := syscall.Syscall6(syscall.SYS_PPOLL, uintptr(unsafe.Pointer(p)), 1, uintptr(unsafe.Pointer(&ts)), 0, 0, 0)
+	return int(n), errno
+}
@@ -0,0 +1,202 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+func TestWaitReadable(t *testing.T) {
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pr.Close()
+	defer pw.Close()
+
+	// past FD_SETSIZE, which select cannot wait for
+	fd := 1500
+	if err := syscall.Dup3(int(pr.Fd()), fd, 0); err != nil {
+		t.Skipf("dup: %v", err)
+	}
+	defer syscall.Close(fd)
+
+	if ok, err := waitReadable(fd, 10*time.Millisecond); ok || err != nil {
+		t.Errorf("empty pipe: got %v, %v", ok, err)
+	}
+	pw.WriteString("x")
+	if ok, err := waitReadable(fd, time.Second); !ok || err != nil {
+		t.Errorf("pipe with input: got %v, %v", ok, err)
+	}
+}
+
+// TestInteractiveHelper is the interactive shell that TestInteractive runs
+// on a terminal.
+func TestInteractiveHelper(t *testing.T) {
+	if os.Getenv("SHELL_TEST_INTERACTIVE") != "1" {
+		return
+	}
+	sh := New(Config{})
+	sh.Run()
+	os.Exit(sh.Exit())
+}
+
+func TestInteractive(t *testing.T) {
+	term := startTerminal(t)
+
+	term.expect("$ ")
+	// Ctrl-C drops the line being typed
+	term.send("echo typed\x03")
+	term.send("echo status=$?\r")
+	term.expect("status=130")
+
+	// and ends a foreground job, not the shell
+	term.send("sleep 10\r")
+	time.Sleep(300 * time.Millisecond)
+	term.send("\x03")
+	term.send("echo status=$?\r")
+	term.expect("status=130")
+
+	term.send("sh -c 'kill -QUIT $$'\r")
+	term.expect("Quit")
+	term.send("echo status=$?\r")
+	term.expect("status=131")
+
+	term.send("sh -c 'exit 131'; echo status=$?\r")
+	if out := term.expect("status=131"); strings.Contains(out, "Quit") {
+		t.Errorf("exit 131 was reported as a signal:\n%s", out)
+	}
+
+	// an interactive shell announces background jobs
+	term.send("true &\r")
+	term.expect("[1] ")
+
+	term.send("exit\r")
+	term.wait()
+}
+
+// terminal is a shell running on a pseudo-terminal.
+type terminal struct {
+	t    *testing.T
+	pty  *os.File
+	cmd  *exec.Cmd
+	done chan struct{}
+
+	mu  sync.Mutex
+	out []byte
+	// seen is how much of out expect already went past.
+	seen int
+}
+
+func startTerminal(t *testing.T) *terminal {
+	t.Helper()
+
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR, 0)
+	if err != nil {
+		t.Skipf("no pseudo-terminal: %v", err)
+	}
+	var unlock int32
+	var n uint32
+	if err := ioctl(master, syscall.TIOCSPTLCK, unsafe.Pointer(&unlock)); err != nil {
+		t.Skipf("no pseudo-terminal: %v", err)
+	}
+	if err := ioctl(master, syscall.TIOCGPTN, unsafe.Pointer(&n)); err != nil {
+		t.Skipf("no pseudo-terminal: %v", err)
+	}
+	slave, err := os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		t.Skipf("no pseudo-terminal: %v", err)
+	}
+	defer slave.Close()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestInteractiveHelper$")
+	cmd.Env = append(os.Environ(), "SHELL_TEST_INTERACTIVE=1", "HOME="+t.TempDir(), "HISTFILE=", "PS1=$ ")
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = slave, slave, slave
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true}
+	if err := cmd.Start(); err != nil {
+		master.Close()
+		t.Fatal(err)
+	}
+
+	term := &terminal{t: t, pty: master, cmd: cmd, done: make(chan struct{})}
+	go func() {
+		defer close(term.done)
+		buf := make([]byte, 1024)
+		for {
+			n, err := master.Read(buf)
+			term.mu.Lock()
+			term.out = append(term.out, buf[:n]...)
+			term.mu.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}()
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+		master.Close()
+		<-term.done
+	})
+	return term
+}
+
+func (term *terminal) send(s string) {
+	if _, err := term.pty.WriteString(s); err != nil {
+		term.t.Fatal(err)
+	}
+	// the line editor reads a key at a time, give it a moment between
+	// writes
+	time.Sleep(50 * time.Millisecond)
+}
+
+// expect waits for s in the output after what was already expected, and
+// returns the output up to and including it.
+func (term *terminal) expect(s string) string {
+	term.t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		term.mu.Lock()
+		out := string(term.out[term.seen:])
+		if i := strings.Index(out, s); i >= 0 {
+			term.seen += i + len(s)
+			term.mu.Unlock()
+			return out[:i+len(s)]
+		}
+		term.mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+	}
+	term.mu.Lock()
+	defer term.mu.Unlock()
+	term.t.Fatalf("no %q in output:\n%s", s, term.out)
+	return ""
+}
+
+// wait waits for the shell to exit.
+func (term *terminal) wait() {
+	term.t.Helper()
+	exited := make(chan error, 1)
+	go func() { exited <- term.cmd.Wait() }()
+	select {
+	case err := <-exited:
+		if err != nil {
+			term.t.Errorf("shell: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		term.t.Fatal("shell did not exit")
+	}
+}
+
+func ioctl(f *os.File, req uint, arg unsafe.Pointer) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), uintptr(req), uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
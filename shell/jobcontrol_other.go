@@ -0,0 +1,22 @@
+//go:build !linux
+
+package shell
+
+import (
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	ioctlGetTermios = syscall.TIOCGETA
+	ioctlSetTermios = syscall.TIOCSETA
+)
+
+// poll waits for the descriptor of p with poll(2), the timeout rounded up
+// to a millisecond.
+func poll(p *pollFd, timeout time.Duration) (int, syscall.Errno) {
+	ms := (timeout + time.Millisecond - 1) / time.Millisecond
+	n, _, errno := syscall.Syscall(syscall.SYS_POLL, uintptr(unsafe.Pointer(p)), 1, uintptr(ms))
+	return int(n), errno
+}
@@ -0,0 +1,189 @@
+package shell
+
+import (
+	"bytes"
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestJobStates(t *testing.T) {
+	j := newJob("sleep 10")
+	if j.State() != JobRunning || j.stateString() != "Running" {
+		t.Fatalf("new job: got %v %q", j.State(), j.stateString())
+	}
+
+	j.stop()
+	if j.State() != JobStopped || j.stateString() != "Stopped" || !j.needsReport() {
+		t.Errorf("stopped: got %v %q, report %v", j.State(), j.stateString(), j.needsReport())
+	}
+	select {
+	case <-j.notify:
+		// put it back for resume to drain
+		j.notify <- struct{}{}
+	default:
+		t.Error("stop did not notify")
+	}
+	j.markReported()
+	if j.needsReport() {
+		t.Error("reported job still needs a report")
+	}
+
+	j.resume()
+	if j.State() != JobRunning {
+		t.Errorf("resumed: got %v", j.State())
+	}
+	select {
+	case <-j.notify:
+		t.Error("resume left the stop notification")
+	default:
+	}
+
+	j.finish(0, 0)
+	select {
+	case <-j.done:
+	default:
+		t.Error("finish did not close done")
+	}
+	if j.State() != JobDone || j.stateString() != "Done" {
+		t.Errorf("finished: got %v %q", j.State(), j.stateString())
+	}
+
+	for _, tt := range []struct {
+		status int
+		sig    syscall.Signal
+		want   string
+	}{
+		{1, 0, "Exit 1"},
+		{137, 0, "Exit 137"},
+		{137, syscall.SIGKILL, "Killed"},
+		{143, syscall.SIGTERM, "Terminated"},
+		{131, syscall.SIGQUIT, "Quit"},
+		{130, syscall.SIGINT, "Interrupt"},
+		{139, syscall.SIGSEGV, "Segmentation fault"},
+	} {
+		j := newJob("x")
+		j.finish(tt.status, tt.sig)
+		if got := j.stateString(); got != tt.want {
+			t.Errorf("finish(%d, %v): got %q, want %q", tt.status, tt.sig, got, tt.want)
+		}
+	}
+}
+
+func TestJobSpec(t *testing.T) {
+	var jobs jobTable
+	for _, cmd := range []string{"sleep 10", "vim notes.txt", "make all"} {
+		jobs.add(newJob(cmd))
+	}
+
+	for _, tt := range []struct {
+		spec string
+		id   int
+		err  string
+	}{
+		{"", 3, ""},
+		{"%", 3, ""},
+		{"%%", 3, ""},
+		{"%+", 3, ""},
+		{"%-", 2, ""},
+		{"%1", 1, ""},
+		{"%vim", 2, ""},
+		{"%?notes", 2, ""},
+		{"%?e", 0, "%?e: ambiguous job spec"},
+		{"%4", 0, "%4: no such job"},
+		{"%emacs", 0, "%emacs: no such job"},
+		{"1", 0, "1: no such job"},
+	} {
+		j, err := jobs.lookup(tt.spec)
+		switch {
+		case tt.err != "":
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("%q: got %v, want error %q", tt.spec, err, tt.err)
+			}
+		case err != nil:
+			t.Errorf("%q: %v", tt.spec, err)
+		case j.ID != tt.id:
+			t.Errorf("%q: got job %d, want %d", tt.spec, j.ID, tt.id)
+		}
+	}
+
+	// fg and bg make the job they use current
+	jobs.use(jobs.byID(1))
+	if j, _ := jobs.lookup("%+"); j.ID != 1 {
+		t.Errorf("%%+ after use: got %d, want 1", j.ID)
+	}
+	if j, _ := jobs.lookup("%-"); j.ID != 3 {
+		t.Errorf("%%- after use: got %d, want 3", j.ID)
+	}
+	if got := jobs.marker(jobs.byID(1)) + jobs.marker(jobs.byID(3)) + jobs.marker(jobs.byID(2)); got != "+- " {
+		t.Errorf("markers: got %q", got)
+	}
+
+	jobs.remove(jobs.byID(1))
+	if j, _ := jobs.lookup("%%"); j.ID != 3 {
+		t.Errorf("%%%% after remove: got %d, want 3", j.ID)
+	}
+}
+
+func TestWaitProcessStop(t *testing.T) {
+	cmd := exec.Command("sleep", "10")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	j := newJob("sleep 10")
+	j.addPid(cmd.Process.Pid)
+	j.setPgid(cmd.Process.Pid)
+
+	done := make(chan error, 1)
+	go func() { done <- waitProcess(cmd.Process, j) }()
+
+	j.signalAll(syscall.SIGSTOP)
+	select {
+	case <-j.notify:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stop was not noticed")
+	}
+	if j.State() != JobStopped {
+		t.Errorf("got %v, want stopped", j.State())
+	}
+
+	j.resume()
+	if j.State() != JobRunning {
+		t.Errorf("got %v, want running", j.State())
+	}
+	j.signalAll(syscall.SIGTERM)
+	err := <-done
+	if sig := exitSignal(err); sig != syscall.SIGTERM {
+		t.Errorf("got %v, want SIGTERM", err)
+	}
+	if status := exitStatus(err); status != 128+int(syscall.SIGTERM) {
+		t.Errorf("got status %d", status)
+	}
+}
+
+func TestReportSignaled(t *testing.T) {
+	for _, tt := range []struct {
+		script string
+		want   string
+	}{
+		{"kill -QUIT $$", "Quit\n"},
+		{"kill -SEGV $$", "Segmentation fault\n"},
+		{"kill -INT $$", "\n"},
+		{"kill -PIPE $$", ""},
+		// an exit status above 128 is not a signal
+		{"exit 130", ""},
+		{"exit 137", ""},
+	} {
+		err := exec.Command("sh", "-c", tt.script).Run()
+		j := newJob(tt.script)
+		j.finish(exitStatus(err), exitSignal(err))
+
+		var buf bytes.Buffer
+		reportSignaled(j, &buf)
+		if buf.String() != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.script, buf.String(), tt.want)
+		}
+	}
+}
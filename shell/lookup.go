@@ -0,0 +1,431 @@
+package shell
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// stdPath is the PATH of `command -p`, where the standard utilities are.
+const stdPath = "/usr/local/bin:/usr/bin:/bin:/usr/sbin:/sbin"
+
+// hashEntry is a program remembered by the hash table.
+type hashEntry struct {
+	path string
+	hits int
+}
+
+// lookPath finds the program for name in the directories of the shell's
+// PATH, the way exec.LookPath does with the process's.
+func (sh *Shell) lookPath(name string) (string, error) {
+	if strings.Contains(name, "/") {
+		if err := findExecutable(sh.abs(name)); err != nil {
+			return "", &exec.Error{Name: name, Err: err}
+		}
+		return name, nil
+	}
+
+	path, _ := sh.getVar("PATH")
+	files := sh.lookPathIn(name, path, false)
+	if len(files) == 0 {
+		return "", &exec.Error{Name: name, Err: exec.ErrNotFound}
+	}
+	return files[0], nil
+}
+
+// lookPathIn returns the first program for name in the directories of
+// path, or every one of them if all is set. A name with a slash is not
+// searched.
+func (sh *Shell) lookPathIn(name, path string, all bool) []string {
+	if strings.Contains(name, "/") {
+		if findExecutable(sh.abs(name)) != nil {
+			return nil
+		}
+		return []string{name}
+	}
+
+	var res []string
+	for _, dir := range filepath.SplitList(path) {
+		if dir == "" {
+			// an empty element means the current directory
+			dir = "."
+		}
+		file := dir + "/" + name
+		if findExecutable(sh.abs(file)) == nil {
+			res = append(res, file)
+			if !all {
+				break
+			}
+		}
+	}
+	return res
+}
+
+func findExecutable(file string) error {
+	fi, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() || fi.Mode()&0111 == 0 {
+		return fs.ErrPermission
+	}
+	return nil
+}
+
+// commandPath finds the program to run for name. A program found in PATH
+// is remembered in the hash table, which is tried first next time.
+func (sh *Shell) commandPath(name string, defaultPath bool) (string, error) {
+	if defaultPath {
+		if files := sh.lookPathIn(name, stdPath, false); len(files) > 0 {
+			return files[0], nil
+		}
+		return "", &exec.Error{Name: name, Err: exec.ErrNotFound}
+	}
+	if strings.Contains(name, "/") {
+		return sh.lookPath(name)
+	}
+
+	if e, ok := sh.hash[name]; ok {
+		if findExecutable(sh.abs(e.path)) == nil {
+			e.hits++
+			sh.hash[name] = e
+			return e.path, nil
+		}
+		// the program moved since
+		delete(sh.hash, name)
+	}
+	path, err := sh.lookPath(name)
+	if err != nil {
+		return "", err
+	}
+	sh.hash[name] = hashEntry{path: path, hits: 1}
+	return path, nil
+}
+
+// resolution is one of the ways a command name can run.
+type resolution struct {
+	// kind is "alias", "keyword", "function", "builtin" or "file", as
+	// `type -t` prints it.
+	kind   string
+	alias  string
+	fn     *FuncDef
+	path   string
+	hashed bool
+}
+
+// resolve returns how name would run, in the order the shell looks, or
+// every way it could run with all. Functions are skipped unless funcs is
+// set.
+func (sh *Shell) resolve(name string, all, funcs bool) []resolution {
+	var res []resolution
+	done := func() bool { return len(res) > 0 && !all }
+
+	if value, ok := sh.aliases[name]; ok {
+		res = append(res, resolution{kind: "alias", alias: value})
+	}
+	if isReservedWord(name) && !done() {
+		res = append(res, resolution{kind: "keyword"})
+	}
+	if fn, ok := sh.funcs[name]; ok && funcs && !done() {
+		res = append(res, resolution{kind: "function", fn: fn})
+	}
+	if _, ok := sh.builtins.Lookup(name); ok && !done() {
+		res = append(res, resolution{kind: "builtin"})
+	}
+	if done() {
+		return res
+	}
+	return append(res, sh.resolveFile(name, all)...)
+}
+
+// resolveFile returns the program for name, the hashed one if there is, or
+// every program in PATH with all.
+func (sh *Shell) resolveFile(name string, all bool) []resolution {
+	if e, ok := sh.hash[name]; ok && !all {
+		return []resolution{{kind: "file", path: e.path, hashed: true}}
+	}
+	var res []resolution
+	path, _ := sh.getVar("PATH")
+	for _, file := range sh.lookPathIn(name, path, all) {
+		res = append(res, resolution{kind: "file", path: file})
+	}
+	return res
+}
+
+// describe writes what r is as `type` and `command -V` say it.
+func (c *Command) describe(name string, r resolution) {
+	out := c.stdio.Out
+	switch r.kind {
+	case "alias":
+		fmt.Fprintf(out, "%s is aliased to `%s'\n", name, r.alias)
+	case "keyword":
+		fmt.Fprintf(out, "%s is a shell keyword\n", name)
+	case "function":
+		fmt.Fprintf(out, "%s is a function\n", name)
+		fmt.Fprintln(out, formatFunction(r.fn))
+	case "builtin":
+		fmt.Fprintf(out, "%s is a shell builtin\n", name)
+	case "file":
+		if r.hashed {
+			fmt.Fprintf(out, "%s is hashed (%s)\n", name, r.path)
+		} else {
+			fmt.Fprintf(out, "%s is %s\n", name, r.path)
+		}
+	}
+}
+
+func (c *Command) execType() error {
+	var (
+		all     bool
+		kind    bool
+		path    bool
+		noFuncs bool
+		force   bool
+	)
+	args := c.Args[1:]
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+		arg := args[0]
+		args = args[1:]
+		if arg == "--" {
+			break
+		}
+		for _, f := range arg[1:] {
+			switch f {
+			case 'a':
+				all = true
+			case 't':
+				kind = true
+			case 'p':
+				path = true
+			case 'P':
+				force = true
+			case 'f':
+				noFuncs = true
+			default:
+				fmt.Fprintf(c.stdio.Err, "type: -%c: invalid option\n", f)
+				fmt.Fprintln(c.stdio.Err, "type: usage: type [-afptP] name [name ...]")
+				return statusError(2)
+			}
+		}
+	}
+
+	status := 0
+	for _, name := range args {
+		var res []resolution
+		if force {
+			// -P searches PATH even for builtins and functions
+			res = c.sh.resolveFile(name, all)
+		} else {
+			res = c.sh.resolve(name, all, !noFuncs)
+		}
+
+		if len(res) == 0 {
+			if !kind && !path && !force {
+				fmt.Fprintf(c.stdio.Err, "%s: not found\n", name)
+			}
+			status = 1
+			continue
+		}
+		for _, r := range res {
+			switch {
+			case kind:
+				fmt.Fprintln(c.stdio.Out, r.kind)
+			case path || force:
+				if r.kind == "file" {
+					fmt.Fprintln(c.stdio.Out, r.path)
+				}
+			default:
+				c.describe(name, r)
+			}
+		}
+	}
+	if status != 0 {
+		return statusError(status)
+	}
+	return nil
+}
+
+// execCommand is reached only for `command -v` and `-V`, otherwise the
+// word is removed before the command starts.
+func (c *Command) execCommand() error {
+	var (
+		short   bool
+		verbose bool
+	)
+	args := c.Args[1:]
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+		arg := args[0]
+		args = args[1:]
+		if arg == "--" {
+			break
+		}
+		for _, f := range arg[1:] {
+			switch f {
+			case 'v':
+				short = true
+			case 'V':
+				verbose = true
+			case 'p':
+			default:
+				fmt.Fprintf(c.stdio.Err, "command: -%c: invalid option\n", f)
+				fmt.Fprintln(c.stdio.Err, "command: usage: command [-pVv] command [arg ...]")
+				return statusError(2)
+			}
+		}
+	}
+	if !short && !verbose {
+		return nil
+	}
+
+	status := 0
+	for _, name := range args {
+		res := c.sh.resolve(name, false, true)
+		if len(res) == 0 {
+			if verbose {
+				fmt.Fprintf(c.stdio.Err, "command: %s: not found\n", name)
+			}
+			status = 1
+			continue
+		}
+		switch r := res[0]; {
+		case verbose:
+			c.describe(name, r)
+		case r.kind == "alias":
+			fmt.Fprintf(c.stdio.Out, "alias %s=%s\n", name, shellQuote(r.alias))
+		case r.kind == "file":
+			fmt.Fprintln(c.stdio.Out, r.path)
+		default:
+			fmt.Fprintln(c.stdio.Out, name)
+		}
+	}
+	if status != 0 {
+		return statusError(status)
+	}
+	return nil
+}
+
+// execBuiltin only runs for a lone `builtin`, with a name the word is
+// removed before the command starts.
+func (c *Command) execBuiltin() error {
+	return nil
+}
+
+func (c *Command) execHash() error {
+	var (
+		reset   bool
+		list    bool
+		forget  bool
+		show    bool
+		setPath string
+	)
+	args := c.Args[1:]
+	usage := func() error {
+		fmt.Fprintln(c.stdio.Err, "hash: usage: hash [-lr] [-p pathname] [-dt] [name ...]")
+		return statusError(2)
+	}
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+		arg := args[0]
+		args = args[1:]
+		if arg == "--" {
+			break
+		}
+		for i := 1; i < len(arg); i++ {
+			switch arg[i] {
+			case 'r':
+				reset = true
+			case 'l':
+				list = true
+			case 'd':
+				forget = true
+			case 't':
+				show = true
+			case 'p':
+				if i+1 < len(arg) {
+					setPath = arg[i+1:]
+				} else if len(args) > 0 {
+					setPath = args[0]
+					args = args[1:]
+				} else {
+					fmt.Fprintln(c.stdio.Err, "hash: -p: option requires an argument")
+					return usage()
+				}
+				i = len(arg)
+			default:
+				fmt.Fprintf(c.stdio.Err, "hash: -%c: invalid option\n", arg[i])
+				return usage()
+			}
+		}
+	}
+
+	sh := c.sh
+	if reset {
+		sh.hash = make(map[string]hashEntry)
+	}
+	if len(args) == 0 {
+		if reset && !list {
+			return nil
+		}
+		if len(sh.hash) == 0 {
+			if !list {
+				fmt.Fprintln(c.stdio.Err, "hash: hash table empty")
+			}
+			return nil
+		}
+		if !list {
+			fmt.Fprintln(c.stdio.Out, "hits\tcommand")
+		}
+		for _, name := range sortedKeys(sh.hash) {
+			e := sh.hash[name]
+			if list {
+				fmt.Fprintf(c.stdio.Out, "builtin hash -p %s %s\n", e.path, name)
+			} else {
+				fmt.Fprintf(c.stdio.Out, "%4d\t%s\n", e.hits, e.path)
+			}
+		}
+		return nil
+	}
+
+	status := 0
+	for _, name := range args {
+		switch {
+		case setPath != "":
+			sh.hash[name] = hashEntry{path: setPath}
+		case forget:
+			if _, ok := sh.hash[name]; !ok {
+				fmt.Fprintf(c.stdio.Err, "hash: %s: not found\n", name)
+				status = 1
+			}
+			delete(sh.hash, name)
+		case show:
+			e, ok := sh.hash[name]
+			if !ok {
+				fmt.Fprintf(c.stdio.Err, "hash: %s: not found\n", name)
+				status = 1
+				continue
+			}
+			if len(args) > 1 {
+				fmt.Fprintf(c.stdio.Out, "%s\t", name)
+			}
+			fmt.Fprintln(c.stdio.Out, e.path)
+		default:
+			// builtins and functions are not hashed
+			if _, ok := sh.builtins.Lookup(name); ok || strings.Contains(name, "/") {
+				continue
+			}
+			path, err := sh.lookPath(name)
+			if err != nil {
+				fmt.Fprintf(c.stdio.Err, "hash: %s: not found\n", name)
+				status = 1
+				continue
+			}
+			sh.hash[name] = hashEntry{path: path}
+		}
+	}
+	if status != 0 {
+		return statusError(status)
+	}
+	return nil
+}
@@ -0,0 +1,242 @@
+package shell
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Option is a shell option, either one of `set -o` or one of `shopt`.
+type Option int
+
+const (
+	OptErrexit Option = iota
+	OptNoclobber
+	OptNoglob
+	OptNounset
+	OptPipefail
+	OptXtrace
+	OptNoexec
+	OptPosix
+	OptLastpipe
+	OptNocasematch
+
+	numOptions
+)
+
+type optionInfo struct {
+	name string
+	// flag is the letter of the option for `set -x` and $-, 0 for none.
+	flag byte
+	// shopt is set for the options managed by shopt instead of set -o.
+	shopt bool
+}
+
+var optionTable = [numOptions]optionInfo{
+	OptErrexit:     {name: "errexit", flag: 'e'},
+	OptNoclobber:   {name: "noclobber", flag: 'C'},
+	OptNoglob:      {name: "noglob", flag: 'f'},
+	OptNounset:     {name: "nounset", flag: 'u'},
+	OptPipefail:    {name: "pipefail"},
+	OptXtrace:      {name: "xtrace", flag: 'x'},
+	OptNoexec:      {name: "noexec", flag: 'n'},
+	OptPosix:       {name: "posix"},
+	OptLastpipe:    {name: "lastpipe", shopt: true},
+	OptNocasematch: {name: "nocasematch", shopt: true},
+}
+
+func (o Option) String() string {
+	return optionTable[o].name
+}
+
+// Options holds the state of every option. It is a value type, a subshell
+// gets a copy.
+type Options [numOptions]bool
+
+func (o *Options) Get(opt Option) bool {
+	return o[opt]
+}
+
+func (o *Options) Set(opt Option, on bool) {
+	o[opt] = on
+}
+
+// Flags returns the letters of the options that are on, as in $-.
+func (o *Options) Flags() string {
+	var sb strings.Builder
+	for opt, info := range optionTable {
+		if info.flag != 0 && o[opt] {
+			sb.WriteByte(info.flag)
+		}
+	}
+	return sb.String()
+}
+
+// lookupOption finds a set -o option by name, or a shopt option when shopt
+// is true.
+func lookupOption(name string, shopt bool) (Option, bool) {
+	for opt, info := range optionTable {
+		if info.name == name && info.shopt == shopt {
+			return Option(opt), true
+		}
+	}
+	return 0, false
+}
+
+func lookupFlag(flag byte) (Option, bool) {
+	for opt, info := range optionTable {
+		if info.flag != 0 && info.flag == flag {
+			return Option(opt), true
+		}
+	}
+	return 0, false
+}
+
+// options returns the options of one kind in table order.
+func options(shopt bool) []Option {
+	var res []Option
+	for opt, info := range optionTable {
+		if info.shopt == shopt {
+			res = append(res, Option(opt))
+		}
+	}
+	return res
+}
+
+func (c *Command) execSet() error {
+	args := c.Args[1:]
+	if len(args) == 0 {
+		for _, name := range sortedKeys(c.sh.vars) {
+			fmt.Fprintln(c.stdio.Out, formatVariable(name, c.sh.vars[name]))
+		}
+		return nil
+	}
+
+	usage := func(arg string) error {
+		fmt.Fprintf(c.stdio.Err, "set: %s: invalid option\n", arg)
+		fmt.Fprintln(c.stdio.Err, "set: usage: set [-efnuxC] [-o option-name] [--] [arg ...]")
+		return statusError(2)
+	}
+
+	setArgs := false
+	for len(args) > 0 {
+		arg := args[0]
+		if arg == "--" {
+			args = args[1:]
+			setArgs = true
+			break
+		}
+		if arg == "-" {
+			// ends the options and turns off tracing
+			args = args[1:]
+			c.sh.opts.Set(OptXtrace, false)
+			setArgs = len(args) > 0
+			break
+		}
+		if len(arg) < 2 || (arg[0] != '-' && arg[0] != '+') {
+			setArgs = true
+			break
+		}
+		args = args[1:]
+
+		on := arg[0] == '-'
+		for i := 1; i < len(arg); i++ {
+			if arg[i] == 'o' {
+				if len(args) == 0 {
+					c.printOptions(c.stdio.Out, on)
+					continue
+				}
+				opt, ok := lookupOption(args[0], false)
+				if !ok {
+					fmt.Fprintf(c.stdio.Err, "set: %s: invalid option name\n", args[0])
+					return statusError(2)
+				}
+				c.sh.opts.Set(opt, on)
+				args = args[1:]
+				continue
+			}
+
+			opt, ok := lookupFlag(arg[i])
+			if !ok {
+				return usage(arg[:1] + arg[i:i+1])
+			}
+			c.sh.opts.Set(opt, on)
+		}
+	}
+
+	if setArgs {
+		c.sh.setPositional(args)
+	}
+	return nil
+}
+
+// printOptions prints the set -o options, as a table for `set -o` and as
+// commands that restore them for `set +o`.
+func (c *Command) printOptions(w io.Writer, table bool) {
+	for _, opt := range options(false) {
+		on := c.sh.opts.Get(opt)
+		if table {
+			fmt.Fprintf(w, "%-15s\t%s\n", opt, onOff(on))
+			continue
+		}
+		sign := "+"
+		if on {
+			sign = "-"
+		}
+		fmt.Fprintf(w, "set %so %s\n", sign, opt)
+	}
+}
+
+// formatVariable renders a variable as `set` lists it, in a form that can
+// be read back.
+func formatVariable(name string, v *Variable) string {
+	if v.Array == nil {
+		return name + "=" + quoteValue(v.Value)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(name + "=(")
+	for i, elem := range v.Array {
+		if i > 0 {
+			sb.WriteByte(' ')
+		}
+		fmt.Fprintf(&sb, "[%d]=%s", i, quoteValue(elem))
+	}
+	sb.WriteByte(')')
+	return sb.String()
+}
+
+// quoteValue quotes s only if the shell would not read it back as is.
+func quoteValue(s string) string {
+	if s == "" {
+		return "''"
+	}
+	for _, r := range s {
+		if !isNameChar(r, false) && !strings.ContainsRune("@%+=:,./-", r) {
+			return shellQuote(s)
+		}
+	}
+	return s
+}
+
+// trace prints an expanded simple command for xtrace, prefixed by PS4.
+func (sh *Shell) trace(w io.Writer, assigns, args []string) {
+	ps4, ok := sh.getVar("PS4")
+	if !ok {
+		ps4 = "+ "
+	}
+	prefix, err := sh.expandAssign(ps4)
+	if err != nil {
+		prefix = ps4
+	}
+
+	words := make([]string, 0, len(assigns)+len(args))
+	for _, kv := range assigns {
+		name, value, _ := strings.Cut(kv, "=")
+		words = append(words, name+"="+quoteValue(value))
+	}
+	for _, arg := range args {
+		words = append(words, quoteValue(arg))
+	}
+	fmt.Fprintf(w, "%s%s\n", prefix, strings.Join(words, " "))
+}
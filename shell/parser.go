@@ -0,0 +1,698 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var (
+	// errIncomplete means the input ended inside a compound command, the
+	// interactive loop reads a continuation line and parses again.
+	errIncomplete = errors.New("syntax error: unexpected end of file")
+)
+
+type syntaxError struct {
+	tok Token
+}
+
+func (e *syntaxError) Error() string {
+	val := e.tok.Val
+	if e.tok.Type == TokenNewline {
+		val = "newline"
+	}
+	return fmt.Sprintf("syntax error near unexpected token `%s'", val)
+}
+
+type Parser struct {
+	tokens []Token
+	pos    int
+	cur    Token
+
+	// aliases are expanded on the first word of each simple command. The
+	// map is read as the parser goes, an alias defined by a line that ran
+	// applies to the lines parsed after it.
+	aliases map[string]string
+}
+
+func NewParser(tokens []Token) *Parser {
+	p := &Parser{
+		tokens: tokens,
+		pos:    0,
+	}
+	if len(tokens) > 0 {
+		p.cur = tokens[0]
+	} else {
+		p.cur = NewToken(TokenEOF, "")
+	}
+	return p
+}
+
+// ParseInput scans and parses a complete command line.
+func ParseInput(input string) (*List, error) {
+	sc := NewScanner(input)
+	tokens := sc.Scan()
+	if sc.Incomplete() {
+		return nil, errIncomplete
+	}
+	return NewParser(tokens).ParseProgram()
+}
+
+// parse scans and parses src with the shell's aliases.
+func (sh *Shell) parse(src string) (*List, error) {
+	p, err := sh.newParser(src, 1)
+	if err != nil {
+		return nil, err
+	}
+	return p.ParseProgram()
+}
+
+// newParser scans src, which starts on the given line of its input, and
+// returns a parser for it that expands the shell's aliases.
+func (sh *Shell) newParser(src string, line int) (*Parser, error) {
+	sc := NewScanner(src)
+	sc.line = line
+	tokens := sc.Scan()
+	if sc.Incomplete() {
+		return nil, errIncomplete
+	}
+	p := NewParser(tokens)
+	p.aliases = sh.aliases
+	return p, nil
+}
+
+func (p *Parser) ParseProgram() (*List, error) {
+	p.skipNewlines()
+
+	list, err := p.parseList()
+	if err != nil {
+		return nil, err
+	}
+	if p.cur.Type != TokenEOF {
+		return nil, &syntaxError{tok: p.cur}
+	}
+	return list, nil
+}
+
+// parseList parses and-or lists until a token that cannot start a command,
+// such as EOF, `)`, `;;` or a closing reserved word.
+func (p *Parser) parseList() (*List, error) {
+	list := &List{}
+
+	for !p.atListEnd() {
+		andOr, err := p.parseAndOr()
+		if err != nil {
+			return nil, err
+		}
+		list.Items = append(list.Items, andOr)
+
+		if p.cur.Type == TokenBackground {
+			andOr.Async = true
+		} else if p.cur.Type != TokenSemicolon && p.cur.Type != TokenNewline {
+			break
+		}
+		p.advance()
+		p.skipNewlines()
+	}
+
+	return list, nil
+}
+
+// parseLine parses the commands up to the end of the next line, which goes
+// on over more lines inside a compound command. It returns nil at the end of
+// the input.
+func (p *Parser) parseLine() (*List, error) {
+	p.skipNewlines()
+	if p.cur.Type == TokenEOF {
+		return nil, nil
+	}
+
+	list := &List{}
+	for !p.atListEnd() {
+		andOr, err := p.parseAndOr()
+		if err != nil {
+			return nil, err
+		}
+		list.Items = append(list.Items, andOr)
+
+		if p.cur.Type == TokenBackground {
+			andOr.Async = true
+		} else if p.cur.Type != TokenSemicolon && p.cur.Type != TokenNewline {
+			break
+		}
+		newline := p.cur.Type == TokenNewline
+		p.advance()
+		if newline {
+			return list, nil
+		}
+		if p.cur.Type == TokenNewline {
+			p.advance()
+			return list, nil
+		}
+	}
+	if p.cur.Type != TokenEOF {
+		return nil, &syntaxError{tok: p.cur}
+	}
+	return list, nil
+}
+
+func (p *Parser) atListEnd() bool {
+	switch p.cur.Type {
+	case TokenEOF, TokenRParen, TokenDSemi, TokenSemiAnd, TokenDSemiAnd:
+		return true
+	case TokenWord:
+		return p.cur.IsReserved("esac") || p.cur.IsReserved("}")
+	}
+	return false
+}
+
+func (p *Parser) parseAndOr() (*AndOr, error) {
+	andOr := &AndOr{}
+
+	for {
+		pipeline, err := p.parsePipeline()
+		if err != nil {
+			return nil, err
+		}
+		andOr.Pipelines = append(andOr.Pipelines, pipeline)
+
+		if p.cur.Type != TokenAnd && p.cur.Type != TokenOr {
+			break
+		}
+		andOr.Ops = append(andOr.Ops, p.cur.Type)
+		p.advance()
+		if err := p.linebreak(); err != nil {
+			return nil, err
+		}
+	}
+
+	return andOr, nil
+}
+
+func (p *Parser) parsePipeline() (*Pipeline, error) {
+	pipeline := &Pipeline{}
+
+	for p.expandAlias() {
+	}
+	if p.cur.IsReserved("!") {
+		pipeline.Negate = true
+		p.advance()
+	}
+
+	for {
+		cmd, err := p.parseCommand()
+		if err != nil {
+			return nil, err
+		}
+		pipeline.Cmds = append(pipeline.Cmds, cmd)
+
+		if p.cur.Type != TokenPipeline {
+			break
+		}
+		p.advance()
+		if err := p.linebreak(); err != nil {
+			return nil, err
+		}
+	}
+
+	return pipeline, nil
+}
+
+func (p *Parser) parseCommand() (Node, error) {
+	for p.expandAlias() {
+	}
+	if p.cur.IsReserved("case") {
+		return p.parseCase()
+	}
+	if p.cur.IsReserved("function") {
+		return p.parseFunction()
+	}
+	if p.cur.Type == TokenLParen {
+		return p.parseSubshell()
+	}
+	if p.cur.IsReserved("{") {
+		return p.parseBraceGroup()
+	}
+	if p.cur.IsReserved("[[") {
+		return p.parseCond()
+	}
+	if p.cur.Type == TokenWord && p.cur.Raw == p.cur.Val && p.peek().Type == TokenLParen {
+		return p.parseFunction()
+	}
+
+	cmd, err := p.parseSimpleCommand()
+	if err != nil {
+		return nil, err
+	}
+	if len(cmd.Words) == 0 && len(cmd.Assigns) == 0 && !cmd.hasRedirect() {
+		if p.cur.Type == TokenEOF {
+			return nil, errIncomplete
+		}
+		return nil, &syntaxError{tok: p.cur}
+	}
+	return cmd, nil
+}
+
+func (p *Parser) parseSimpleCommand() (*Command, error) {
+	cmd := NewCommand(nil)
+	cmd.Line = p.cur.Line
+
+	for {
+
+		switch p.cur.Type {
+		case TokenWord:
+			if len(cmd.Words) == 0 && isAssignment(p.cur.Raw) {
+				cmd.Assigns = append(cmd.Assigns, p.cur)
+			} else if (len(cmd.Words) == 0 || p.cur.checkAlias) && p.expandAlias() {
+				// the expansion is parsed in place of the word
+				continue
+			} else {
+				cmd.Words = append(cmd.Words, p.cur)
+			}
+			p.advance()
+		case TokenRedirectOut, TokenRedirectOutAppend, TokenRedirectErr, TokenRedirectErrAppend, TokenRedirectIn:
+			if err := p.parseRedirect(&cmd.Redirects); err != nil {
+				return nil, err
+			}
+		default:
+			return cmd, nil
+		}
+	}
+}
+
+func (p *Parser) parseRedirect(r *Redirects) error {
+	curType := p.cur.Type
+	force := strings.HasSuffix(p.cur.Val, "|")
+
+	p.advance()
+	if p.cur.Type != TokenWord {
+		return p.unexpected()
+	}
+	rd := Redirect{
+		TokenType: curType,
+		FileName:  p.cur.Val,
+		Target:    p.cur,
+		Force:     force,
+	}
+	switch curType {
+	case TokenRedirectOut, TokenRedirectOutAppend:
+		r.RedirectOutput = rd
+	case TokenRedirectErr, TokenRedirectErrAppend:
+		r.RedirectErr = rd
+	case TokenRedirectIn:
+		r.RedirectIn = rd
+	}
+	p.advance()
+	return nil
+}
+
+// parseRedirects parses the redirections that may follow a compound
+// command.
+func (p *Parser) parseRedirects(r *Redirects) error {
+	for {
+		switch p.cur.Type {
+		case TokenRedirectOut, TokenRedirectOutAppend, TokenRedirectErr, TokenRedirectErrAppend, TokenRedirectIn:
+			if err := p.parseRedirect(r); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+func (p *Parser) parseSubshell() (*Subshell, error) {
+	p.advance()
+	p.skipNewlines()
+
+	body, err := p.parseList()
+	if err != nil {
+		return nil, err
+	}
+	if p.cur.Type != TokenRParen {
+		return nil, p.unexpected()
+	}
+	if len(body.Items) == 0 {
+		return nil, &syntaxError{tok: p.cur}
+	}
+	p.advance()
+
+	sub := &Subshell{Body: body}
+	if err := p.parseRedirects(&sub.Redirects); err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+func (p *Parser) parseBraceGroup() (*BraceGroup, error) {
+	p.advance()
+	p.skipNewlines()
+
+	body, err := p.parseList()
+	if err != nil {
+		return nil, err
+	}
+	if !p.cur.IsReserved("}") {
+		return nil, p.unexpected()
+	}
+	if len(body.Items) == 0 {
+		return nil, &syntaxError{tok: p.cur}
+	}
+	p.advance()
+
+	group := &BraceGroup{Body: body}
+	if err := p.parseRedirects(&group.Redirects); err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+// parseCond parses `[[ expression ]]` with the precedence, from lowest,
+// `||`, `&&`, `!`, then parentheses and primaries.
+func (p *Parser) parseCond() (*CondCommand, error) {
+	p.advance()
+	if p.cur.IsReserved("]]") {
+		return nil, p.unexpected()
+	}
+
+	expr, err := p.parseCondOr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.cur.IsReserved("]]") {
+		return nil, p.unexpected()
+	}
+	p.advance()
+
+	return &CondCommand{Expr: expr}, nil
+}
+
+func (p *Parser) parseCondOr() (*CondExpr, error) {
+	x, err := p.parseCondAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.cur.Type == TokenOr {
+		p.advance()
+		p.skipNewlines()
+		y, err := p.parseCondAnd()
+		if err != nil {
+			return nil, err
+		}
+		x = &CondExpr{Op: "||", X: x, Y: y}
+	}
+	return x, nil
+}
+
+func (p *Parser) parseCondAnd() (*CondExpr, error) {
+	x, err := p.parseCondNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.cur.Type == TokenAnd {
+		p.advance()
+		p.skipNewlines()
+		y, err := p.parseCondNot()
+		if err != nil {
+			return nil, err
+		}
+		x = &CondExpr{Op: "&&", X: x, Y: y}
+	}
+	return x, nil
+}
+
+func (p *Parser) parseCondNot() (*CondExpr, error) {
+	if p.cur.IsReserved("!") {
+		p.advance()
+		x, err := p.parseCondNot()
+		if err != nil {
+			return nil, err
+		}
+		return &CondExpr{Op: "!", X: x}, nil
+	}
+	return p.parseCondPrimary()
+}
+
+func (p *Parser) parseCondPrimary() (*CondExpr, error) {
+	if p.cur.Type == TokenLParen {
+		p.advance()
+		x, err := p.parseCondOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.cur.Type != TokenRParen {
+			return nil, p.unexpected()
+		}
+		p.advance()
+		return &CondExpr{Op: "(", X: x}, nil
+	}
+
+	if p.cur.Type != TokenWord || p.cur.IsReserved("]]") {
+		return nil, p.unexpected()
+	}
+	first := p.cur
+	p.advance()
+
+	if unaryTestOps[first.Raw] && p.cur.Type == TokenWord && !p.cur.IsReserved("]]") {
+		operand := p.cur
+		p.advance()
+		return &CondExpr{Op: first.Raw, Words: []Token{operand}}, nil
+	}
+
+	if p.cur.Type == TokenWord && condBinaryOps[p.cur.Raw] {
+		op := p.cur.Raw
+		p.advance()
+		if p.cur.Type != TokenWord || p.cur.IsReserved("]]") {
+			return nil, p.unexpected()
+		}
+		second := p.cur
+		p.advance()
+		return &CondExpr{Op: op, Words: []Token{first, second}}, nil
+	}
+
+	return &CondExpr{Words: []Token{first}}, nil
+}
+
+// parseCase parses
+//
+//	case WORD in [(]PATTERN[|PATTERN]...) LIST ;; ... esac
+//
+// where each item may also end with `;&` or `;;&`.
+func (p *Parser) parseCase() (*CaseClause, error) {
+	p.advance()
+	if p.cur.Type != TokenWord {
+		return nil, p.unexpected()
+	}
+	clause := &CaseClause{Word: p.cur}
+	p.advance()
+
+	if err := p.linebreak(); err != nil {
+		return nil, err
+	}
+	if !p.cur.IsReserved("in") {
+		return nil, p.unexpected()
+	}
+	p.advance()
+	if err := p.linebreak(); err != nil {
+		return nil, err
+	}
+
+	for !p.cur.IsReserved("esac") {
+		item := &CaseItem{Term: TokenDSemi}
+
+		if p.cur.Type == TokenLParen {
+			p.advance()
+		}
+		for {
+			if p.cur.Type != TokenWord {
+				return nil, p.unexpected()
+			}
+			item.Patterns = append(item.Patterns, p.cur)
+			p.advance()
+			if p.cur.Type != TokenPipeline {
+				break
+			}
+			p.advance()
+		}
+		if p.cur.Type != TokenRParen {
+			return nil, p.unexpected()
+		}
+		p.advance()
+		p.skipNewlines()
+
+		body, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+		item.Body = body
+		clause.Items = append(clause.Items, item)
+
+		switch p.cur.Type {
+		case TokenDSemi, TokenSemiAnd, TokenDSemiAnd:
+			item.Term = p.cur.Type
+			p.advance()
+			if err := p.linebreak(); err != nil {
+				return nil, err
+			}
+		case TokenWord:
+			if !p.cur.IsReserved("esac") {
+				return nil, p.unexpected()
+			}
+		default:
+			return nil, p.unexpected()
+		}
+	}
+	p.advance()
+
+	return clause, nil
+}
+
+// parseFunction parses both `name() { ...; }` and `function name { ...; }`,
+// the parentheses being optional in the second form. The body may also be a
+// subshell.
+func (p *Parser) parseFunction() (*FuncDef, error) {
+	keyword := p.cur.IsReserved("function")
+	if keyword {
+		p.advance()
+		if p.cur.Type != TokenWord {
+			return nil, p.unexpected()
+		}
+	}
+	def := &FuncDef{Name: p.cur.Val}
+	p.advance()
+
+	if p.cur.Type == TokenLParen {
+		p.advance()
+		if p.cur.Type != TokenRParen {
+			return nil, p.unexpected()
+		}
+		p.advance()
+	} else if !keyword {
+		return nil, p.unexpected()
+	}
+
+	if err := p.linebreak(); err != nil {
+		return nil, err
+	}
+
+	var err error
+	switch {
+	case p.cur.IsReserved("{"):
+		def.Body, err = p.parseBraceGroup()
+	case p.cur.Type == TokenLParen:
+		def.Body, err = p.parseSubshell()
+	default:
+		return nil, p.unexpected()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return def, nil
+}
+
+// expandAlias replaces the current word with the tokens of its alias and
+// reports whether it did. Quoted words, reserved words and the aliases being
+// expanded already are left alone. If the alias ends with a blank, the word
+// after it is expanded as well.
+func (p *Parser) expandAlias() bool {
+	tok := p.cur
+	if tok.Type != TokenWord || tok.Raw != tok.Val || isReservedWord(tok.Raw) || slices.Contains(tok.aliases, tok.Raw) {
+		return false
+	}
+	value, ok := p.aliases[tok.Raw]
+	if !ok {
+		return false
+	}
+
+	expansion := NewScanner(value).Scan()
+	for i := range expansion {
+		expansion[i].aliases = append(slices.Clip(tok.aliases), tok.Raw)
+		expansion[i].Line = tok.Line
+	}
+	if len(expansion) > 0 {
+		// the first word is in the place of the alias and may be one too
+		expansion[0].checkAlias = true
+	}
+
+	rest := p.tokens[p.pos+1:]
+	if len(rest) > 0 && (strings.HasSuffix(value, " ") || strings.HasSuffix(value, "\t")) {
+		rest = slices.Clone(rest)
+		rest[0].checkAlias = true
+	}
+	p.tokens = slices.Concat(p.tokens[:p.pos], expansion, rest)
+	p.pos--
+	p.advance()
+	return true
+}
+
+// linebreak skips newlines that may follow an operator and reports an
+// incomplete input if nothing comes after them.
+func (p *Parser) linebreak() error {
+	p.skipNewlines()
+	if p.cur.Type == TokenEOF {
+		return errIncomplete
+	}
+	return nil
+}
+
+func (p *Parser) skipNewlines() {
+	for p.cur.Type == TokenNewline {
+		p.advance()
+	}
+}
+
+func (p *Parser) unexpected() error {
+	if p.cur.Type == TokenEOF {
+		return errIncomplete
+	}
+	return &syntaxError{tok: p.cur}
+}
+
+func (p *Parser) advance() {
+	p.pos += 1
+	if p.pos >= len(p.tokens) {
+		p.cur = NewToken(TokenEOF, "")
+	} else {
+		p.cur = p.tokens[p.pos]
+	}
+}
+
+// line returns the line the parser is at, the last one at the end of the
+// input.
+func (p *Parser) line() int {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos].Line
+	}
+	if len(p.tokens) > 0 {
+		return p.tokens[len(p.tokens)-1].Line
+	}
+	return 1
+}
+
+func (p *Parser) peek() Token {
+	if p.pos+1 >= len(p.tokens) {
+		return NewToken(TokenEOF, "")
+	}
+	return p.tokens[p.pos+1]
+}
+
+// isAssignment reports whether the raw word has the form NAME=value.
+func isAssignment(raw string) bool {
+	for i, c := range raw {
+		if c == '=' {
+			return i > 0
+		}
+		if !isNameChar(c, i == 0) {
+			return false
+		}
+	}
+	return false
+}
+
+func isNameChar(c rune, first bool) bool {
+	if c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') {
+		return true
+	}
+	return !first && '0' <= c && c <= '9'
+}
@@ -0,0 +1,58 @@
+package shell
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParser(t *testing.T) {
+	tokens := NewScanner("ls /tmp/baz > /tmp/foo/baz.md").Scan()
+	cmd, err := NewParser(tokens).parseSimpleCommand()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fmt.Println(cmd)
+}
+
+func TestParser2(t *testing.T) {
+	tokens := NewScanner("echo test | head").Scan()
+	cmd, err := NewParser(tokens).parseSimpleCommand()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fmt.Println(cmd)
+}
+
+func TestParseCase(t *testing.T) {
+	prog, err := ParseInput("case \"$1\" in\n  start|stop) echo run;;\n  (*) echo other;&\n  x) ;;&\nesac")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clause, ok := prog.Items[0].Pipelines[0].Cmds[0].(*CaseClause)
+	if !ok {
+		t.Fatalf("got %T, want *CaseClause", prog.Items[0].Pipelines[0].Cmds[0])
+	}
+	if len(clause.Items) != 3 {
+		t.Fatalf("got %d items, want 3", len(clause.Items))
+	}
+	if len(clause.Items[0].Patterns) != 2 {
+		t.Errorf("got %d patterns, want 2", len(clause.Items[0].Patterns))
+	}
+	wantTerms := []TokenType{TokenDSemi, TokenSemiAnd, TokenDSemiAnd}
+	for i, item := range clause.Items {
+		if item.Term != wantTerms[i] {
+			t.Errorf("item %d: got %s, want %s", i, item.Term, wantTerms[i])
+		}
+	}
+}
+
+func TestParseIncomplete(t *testing.T) {
+	for _, input := range []string{"case x in", "case x in a) echo", "echo a &&", "echo a |", "echo 'a"} {
+		if _, err := ParseInput(input); err != errIncomplete {
+			t.Errorf("%q: got %v, want errIncomplete", input, err)
+		}
+	}
+}
@@ -0,0 +1,516 @@
+package shell
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// expandEscapes interprets the backslash escapes of echo -e and printf %b.
+// With bareOctal, as for %b, an octal escape may also leave out the leading
+// zero. stop is set if \c was met, nothing after it is printed.
+func expandEscapes(s string, bareOctal bool) (res string, stop bool) {
+	var sb strings.Builder
+	for i := 0; i < len(s); {
+		if s[i] != '\\' {
+			sb.WriteByte(s[i])
+			i++
+			continue
+		}
+		// \nnn is read the way the format reads it
+		format := bareOctal && i+1 < len(s) && s[i+1] >= '1' && s[i+1] <= '7'
+		var out string
+		out, i, stop = escape(s, i, format)
+		sb.WriteString(out)
+		if stop {
+			break
+		}
+	}
+	return sb.String(), stop
+}
+
+// escape interprets the backslash escape at s[i] and returns the index past
+// it. In the format of printf octal escapes have up to three digits, for
+// echo -e they are a zero followed by up to three digits. %b takes both.
+func escape(s string, i int, format bool) (out string, next int, stop bool) {
+	if i+1 == len(s) {
+		return "\\", i + 1, false
+	}
+	c := s[i+1]
+	next = i + 2
+	switch c {
+	case 'a':
+		return "\a", next, false
+	case 'b':
+		return "\b", next, false
+	case 'c':
+		return "", next, true
+	case 'e', 'E':
+		return "\x1b", next, false
+	case 'f':
+		return "\f", next, false
+	case 'n':
+		return "\n", next, false
+	case 'r':
+		return "\r", next, false
+	case 't':
+		return "\t", next, false
+	case 'v':
+		return "\v", next, false
+	case '\\':
+		return "\\", next, false
+	case '"', '\'', '?':
+		if format {
+			return string(c), next, false
+		}
+	case '0', '1', '2', '3', '4', '5', '6', '7':
+		if !format && c != '0' {
+			break
+		}
+		start := i + 1
+		if !format {
+			start++
+		}
+		n, end := 0, start
+		for end < len(s) && end-start < 3 && s[end] >= '0' && s[end] <= '7' {
+			n = n*8 + int(s[end]-'0')
+			end++
+		}
+		return string([]byte{byte(n)}), end, false
+	case 'x', 'u', 'U':
+		digits := 2
+		if c == 'u' {
+			digits = 4
+		} else if c == 'U' {
+			digits = 8
+		}
+		end := next
+		for end < len(s) && end-next < digits && isHexDigit(s[end]) {
+			end++
+		}
+		if end == next {
+			break
+		}
+		n, _ := strconv.ParseUint(s[next:end], 16, 32)
+		if c == 'x' {
+			return string([]byte{byte(n)}), end, false
+		}
+		return string(rune(n)), end, false
+	}
+	return s[i:next], next, false
+}
+
+func isHexDigit(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+func (c *Command) execEcho() error {
+	args := c.Args[1:]
+	newline, escapes := true, false
+
+	// options are only taken while every letter is one of n, e and E
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' &&
+		strings.Trim(args[0][1:], "neE") == "" {
+		for _, f := range args[0][1:] {
+			switch f {
+			case 'n':
+				newline = false
+			case 'e':
+				escapes = true
+			case 'E':
+				escapes = false
+			}
+		}
+		args = args[1:]
+	}
+
+	out := strings.Join(args, " ")
+	if escapes {
+		var stop bool
+		out, stop = expandEscapes(out, false)
+		if stop {
+			newline = false
+		}
+	}
+	if newline {
+		out += "\n"
+	}
+	fmt.Fprint(c.stdio.Out, out)
+	return nil
+}
+
+func (c *Command) execPrintf() error {
+	args := c.Args[1:]
+	varName := ""
+	if len(args) > 0 && args[0] == "-v" {
+		if len(args) < 2 {
+			fmt.Fprintln(c.stdio.Err, "printf: -v: option requires an argument")
+			fmt.Fprintln(c.stdio.Err, "printf: usage: printf [-v var] format [arguments]")
+			return statusError(2)
+		}
+		varName = args[1]
+		if !isName(varName) {
+			fmt.Fprintf(c.stdio.Err, "printf: `%s': not a valid identifier\n", varName)
+			return statusError(2)
+		}
+		args = args[2:]
+	}
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		fmt.Fprintln(c.stdio.Err, "printf: usage: printf [-v var] format [arguments]")
+		return statusError(2)
+	}
+
+	p := &printer{sh: c.sh, args: args[1:]}
+	p.run(args[0])
+	for _, msg := range p.errs {
+		fmt.Fprintf(c.stdio.Err, "printf: %s\n", msg)
+	}
+
+	if varName != "" {
+		c.sh.setVar(varName, p.out.String())
+	} else {
+		fmt.Fprint(c.stdio.Out, p.out.String())
+	}
+	if len(p.errs) > 0 {
+		return statusError(1)
+	}
+	return nil
+}
+
+// printer formats the arguments of printf.
+type printer struct {
+	sh   *Shell
+	args []string
+	out  strings.Builder
+	errs []string
+	// stop is set by \c in a %b argument
+	stop bool
+}
+
+// run applies format to the arguments, again and again while some are
+// left and the format consumes any.
+func (p *printer) run(format string) {
+	for {
+		before := len(p.args)
+		p.format(format)
+		if p.stop || len(p.args) == 0 || len(p.args) == before {
+			return
+		}
+	}
+}
+
+func (p *printer) next() (string, bool) {
+	if len(p.args) == 0 {
+		return "", false
+	}
+	arg := p.args[0]
+	p.args = p.args[1:]
+	return arg, true
+}
+
+func (p *printer) format(format string) {
+	for i := 0; i < len(format) && !p.stop; i++ {
+		switch format[i] {
+		case '\\':
+			out, next, stop := escape(format, i, true)
+			p.out.WriteString(out)
+			if stop {
+				p.stop = true
+				return
+			}
+			i = next - 1
+		case '%':
+			i = p.conversion(format, i+1) - 1
+		default:
+			p.out.WriteByte(format[i])
+		}
+	}
+}
+
+// conversion formats one %-conversion starting after the % at format[i]
+// and returns the index past it.
+func (p *printer) conversion(format string, i int) int {
+	if i < len(format) && format[i] == '%' {
+		p.out.WriteByte('%')
+		return i + 1
+	}
+
+	start := i
+	for i < len(format) && strings.IndexByte("-+ #0", format[i]) >= 0 {
+		i++
+	}
+	flags := format[start:i]
+
+	width, i := p.number(format, i)
+	prec := ""
+	if i < len(format) && format[i] == '.' {
+		prec, i = p.number(format, i+1)
+		prec = "." + prec
+	}
+
+	if i >= len(format) {
+		p.errs = append(p.errs, fmt.Sprintf("`%s': missing format character", format[start-1:]))
+		p.out.WriteString(format[start-1:])
+		return i
+	}
+
+	spec := "%" + flags + width + prec
+	arg, _ := p.next()
+	switch conv := format[i]; conv {
+	case 's':
+		p.out.WriteString(fmt.Sprintf(spec+"s", arg))
+	case 'b':
+		s, stop := expandEscapes(arg, true)
+		p.out.WriteString(fmt.Sprintf(spec+"s", s))
+		p.stop = stop
+	case 'q':
+		p.out.WriteString(fmt.Sprintf(spec+"s", backslashQuote(arg)))
+	case 'c':
+		r, _ := utf8.DecodeRuneInString(arg)
+		if arg == "" {
+			p.out.WriteString(fmt.Sprintf(spec+"s", ""))
+		} else {
+			p.out.WriteString(fmt.Sprintf(spec+"c", r))
+		}
+	case 'd', 'i':
+		p.out.WriteString(fmt.Sprintf(spec+"d", p.integer(arg)))
+	case 'o', 'x', 'X':
+		p.out.WriteString(fmt.Sprintf(spec+string(conv), uint64(p.integer(arg))))
+	case 'u':
+		p.out.WriteString(fmt.Sprintf(spec+"d", uint64(p.integer(arg))))
+	case 'f', 'F', 'e', 'E', 'g', 'G':
+		if conv == 'F' {
+			conv = 'f'
+		}
+		p.out.WriteString(fmt.Sprintf(spec+string(conv), p.float(arg)))
+	case '(':
+		end := strings.Index(format[i:], ")T")
+		if end < 0 {
+			p.errs = append(p.errs, fmt.Sprintf("`%s': invalid format character", format[start-1:]))
+			return len(format)
+		}
+		layout := format[i+1 : i+end]
+		if layout == "" {
+			layout = "%X"
+		}
+		p.out.WriteString(fmt.Sprintf(spec+"s", strftime(layout, p.time(arg))))
+		return i + end + 2
+	default:
+		p.errs = append(p.errs, fmt.Sprintf("`%c': invalid format character", conv))
+		return len(format)
+	}
+	return i + 1
+}
+
+// backslashQuote quotes s for %q the way bash does: each special character
+// gets a backslash, and a string with control characters or bad UTF-8 is
+// written as $'...' instead.
+func backslashQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	if !utf8.ValidString(s) || strings.IndexFunc(s, isControl) >= 0 {
+		return dollarQuote(s)
+	}
+	var sb strings.Builder
+	for i, r := range s {
+		switch {
+		case strings.ContainsRune(" !\"$&'()*,;<>?[\\]^`{|}", r),
+			r == '#' && i == 0,
+			r == '~' && (i == 0 || s[i-1] == ':' || s[i-1] == '='):
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// dollarQuote writes s as $'...' with C escapes for what is not printable.
+func dollarQuote(s string) string {
+	var sb strings.Builder
+	sb.WriteString("$'")
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			fmt.Fprintf(&sb, "\\%03o", s[i])
+		case r == 0x1b:
+			sb.WriteString("\\E")
+		case r == '\\' || r == '\'':
+			sb.WriteByte('\\')
+			sb.WriteRune(r)
+		case strings.ContainsRune("\a\b\f\n\r\t\v", r):
+			sb.WriteString(strconv.Quote(string(r))[1:3])
+		case isControl(r):
+			for _, b := range []byte(string(r)) {
+				fmt.Fprintf(&sb, "\\%03o", b)
+			}
+		default:
+			sb.WriteRune(r)
+		}
+		i += size
+	}
+	sb.WriteByte('\'')
+	return sb.String()
+}
+
+// isControl reports whether r needs an escape in $'...'.
+func isControl(r rune) bool {
+	return !unicode.IsPrint(r) && r != ' '
+}
+
+// number reads a width or precision, taking it from the arguments for *.
+func (p *printer) number(format string, i int) (string, int) {
+	if i < len(format) && format[i] == '*' {
+		arg, _ := p.next()
+		return strconv.FormatInt(p.integer(arg), 10), i + 1
+	}
+	start := i
+	for i < len(format) && format[i] >= '0' && format[i] <= '9' {
+		i++
+	}
+	return format[start:i], i
+}
+
+// integer converts a numeric argument. A leading quote gives the code of
+// the character after it.
+func (p *printer) integer(arg string) int64 {
+	if arg == "" {
+		return 0
+	}
+	if arg[0] == '\'' || arg[0] == '"' {
+		r, _ := utf8.DecodeRuneInString(arg[1:])
+		return int64(r)
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(arg), 0, 64)
+	if err != nil {
+		if u, uerr := strconv.ParseUint(strings.TrimSpace(arg), 0, 64); uerr == nil {
+			return int64(u)
+		}
+		p.errs = append(p.errs, fmt.Sprintf("%s: invalid number", arg))
+	}
+	return n
+}
+
+func (p *printer) float(arg string) float64 {
+	if arg == "" {
+		return 0
+	}
+	if arg[0] == '\'' || arg[0] == '"' {
+		r, _ := utf8.DecodeRuneInString(arg[1:])
+		return float64(r)
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(arg), 64)
+	if err != nil {
+		p.errs = append(p.errs, fmt.Sprintf("%s: invalid number", arg))
+	}
+	return f
+}
+
+// time converts the argument of %(fmt)T: seconds since the epoch, -1 or
+// nothing for now, -2 for when the shell started.
+func (p *printer) time(arg string) time.Time {
+	if arg == "" {
+		return time.Now()
+	}
+	switch n := p.integer(arg); n {
+	case -1:
+		return time.Now()
+	case -2:
+		return p.sh.started
+	default:
+		return time.Unix(n, 0)
+	}
+}
+
+// strftime formats t like the C function of the same name.
+func strftime(layout string, t time.Time) string {
+	var sb strings.Builder
+	for i := 0; i < len(layout); i++ {
+		if layout[i] != '%' || i+1 == len(layout) {
+			sb.WriteByte(layout[i])
+			continue
+		}
+		i++
+		switch layout[i] {
+		case 'a':
+			sb.WriteString(t.Format("Mon"))
+		case 'A':
+			sb.WriteString(t.Format("Monday"))
+		case 'b', 'h':
+			sb.WriteString(t.Format("Jan"))
+		case 'B':
+			sb.WriteString(t.Format("January"))
+		case 'c':
+			sb.WriteString(t.Format("Mon Jan _2 15:04:05 2006"))
+		case 'C':
+			fmt.Fprintf(&sb, "%02d", t.Year()/100)
+		case 'd':
+			fmt.Fprintf(&sb, "%02d", t.Day())
+		case 'D':
+			sb.WriteString(t.Format("01/02/06"))
+		case 'e':
+			fmt.Fprintf(&sb, "%2d", t.Day())
+		case 'F':
+			sb.WriteString(t.Format("2006-01-02"))
+		case 'H':
+			fmt.Fprintf(&sb, "%02d", t.Hour())
+		case 'I':
+			fmt.Fprintf(&sb, "%02d", (t.Hour()+11)%12+1)
+		case 'j':
+			fmt.Fprintf(&sb, "%03d", t.YearDay())
+		case 'k':
+			fmt.Fprintf(&sb, "%2d", t.Hour())
+		case 'l':
+			fmt.Fprintf(&sb, "%2d", (t.Hour()+11)%12+1)
+		case 'm':
+			fmt.Fprintf(&sb, "%02d", int(t.Month()))
+		case 'M':
+			fmt.Fprintf(&sb, "%02d", t.Minute())
+		case 'n':
+			sb.WriteByte('\n')
+		case 'p':
+			sb.WriteString(t.Format("PM"))
+		case 'r':
+			sb.WriteString(t.Format("03:04:05 PM"))
+		case 'R':
+			sb.WriteString(t.Format("15:04"))
+		case 's':
+			fmt.Fprintf(&sb, "%d", t.Unix())
+		case 'S':
+			fmt.Fprintf(&sb, "%02d", t.Second())
+		case 't':
+			sb.WriteByte('\t')
+		case 'T':
+			sb.WriteString(t.Format("15:04:05"))
+		case 'u':
+			fmt.Fprintf(&sb, "%d", (int(t.Weekday())+6)%7+1)
+		case 'w':
+			fmt.Fprintf(&sb, "%d", int(t.Weekday()))
+		case 'x':
+			sb.WriteString(t.Format("01/02/06"))
+		case 'X':
+			sb.WriteString(t.Format("15:04:05"))
+		case 'y':
+			fmt.Fprintf(&sb, "%02d", t.Year()%100)
+		case 'Y':
+			fmt.Fprintf(&sb, "%d", t.Year())
+		case 'z':
+			sb.WriteString(t.Format("-0700"))
+		case 'Z':
+			sb.WriteString(t.Format("MST"))
+		case '%':
+			sb.WriteByte('%')
+		default:
+			sb.WriteByte('%')
+			sb.WriteByte(layout[i])
+		}
+	}
+	return sb.String()
+}
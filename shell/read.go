@@ -0,0 +1,347 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/chzyer/readline"
+)
+
+// readOptions are the options of the read builtin.
+type readOptions struct {
+	raw     bool
+	prompt  string
+	array   string
+	delim   byte
+	nchars  int // -1 reads up to the delimiter
+	timeout time.Duration
+	hasTime bool
+	silent  bool
+}
+
+// readStatusTimeout is the status of read when the timeout passed, as for
+// a command killed by SIGALRM.
+const readStatusTimeout = 128 + int(syscall.SIGALRM)
+
+func (c *Command) parseReadOptions() (readOptions, []string, error) {
+	opts := readOptions{delim: '\n', nchars: -1}
+	usage := func() error {
+		fmt.Fprintln(c.stdio.Err, "read: usage: read [-rs] [-a array] [-d delim] [-n nchars] [-p prompt] [-t timeout] [name ...]")
+		return statusError(2)
+	}
+
+	args := c.Args[1:]
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+		arg := args[0]
+		args = args[1:]
+		if arg == "--" {
+			break
+		}
+		for i := 1; i < len(arg); i++ {
+			f := arg[i]
+			if f == 'r' || f == 's' {
+				opts.raw = opts.raw || f == 'r'
+				opts.silent = opts.silent || f == 's'
+				continue
+			}
+			if strings.IndexByte("padnt", f) < 0 {
+				fmt.Fprintf(c.stdio.Err, "read: -%c: invalid option\n", f)
+				return opts, nil, usage()
+			}
+
+			// the value is the rest of the word or the next argument
+			value := arg[i+1:]
+			if value == "" {
+				if len(args) == 0 {
+					fmt.Fprintf(c.stdio.Err, "read: -%c: option requires an argument\n", f)
+					return opts, nil, usage()
+				}
+				value = args[0]
+				args = args[1:]
+			}
+			i = len(arg)
+
+			switch f {
+			case 'p':
+				opts.prompt = value
+			case 'a':
+				opts.array = value
+			case 'd':
+				// an empty delimiter is the NUL byte
+				opts.delim = 0
+				if value != "" {
+					opts.delim = value[0]
+				}
+			case 'n':
+				n, err := strconv.Atoi(value)
+				if err != nil || n < 0 {
+					fmt.Fprintf(c.stdio.Err, "read: %s: invalid number\n", value)
+					return opts, nil, statusError(1)
+				}
+				opts.nchars = n
+			case 't':
+				secs, err := strconv.ParseFloat(value, 64)
+				if err != nil || secs < 0 {
+					fmt.Fprintf(c.stdio.Err, "read: %s: invalid timeout specification\n", value)
+					return opts, nil, statusError(1)
+				}
+				opts.timeout = time.Duration(secs * float64(time.Second))
+				opts.hasTime = true
+			}
+		}
+	}
+
+	for _, name := range append(args, opts.array) {
+		if name != "" && !isName(name) {
+			fmt.Fprintf(c.stdio.Err, "read: `%s': not a valid identifier\n", name)
+			return opts, nil, statusError(1)
+		}
+	}
+	return opts, args, nil
+}
+
+func (c *Command) execRead() error {
+	opts, names, err := c.parseReadOptions()
+	if err != nil {
+		return err
+	}
+
+	in, _ := c.stdio.In.(*os.File)
+	fd := -1
+	if in != nil {
+		fd = int(in.Fd())
+	}
+	tty := fd >= 0 && readline.IsTerminal(fd)
+
+	if opts.hasTime && opts.timeout == 0 {
+		// -t 0 only tells whether there is input
+		if fd < 0 {
+			return nil
+		}
+		if ok, _ := waitReadable(fd, 0); !ok {
+			return statusError(1)
+		}
+		return nil
+	}
+
+	if tty {
+		if opts.prompt != "" {
+			// the prompt is not an error message, it goes out as it is
+			w := c.stdio.Err
+			if pw, ok := w.(*prefixWriter); ok {
+				w = pw.w
+			}
+			fmt.Fprint(w, opts.prompt)
+		}
+		if restore := setReadMode(fd, opts); restore != nil {
+			defer restore()
+		}
+	}
+
+	r := &inputReader{r: c.stdio.In, fd: fd}
+	if opts.hasTime {
+		r.deadline = time.Now().Add(opts.timeout)
+	}
+	text, escaped, err := r.readInput(opts)
+	c.assignRead(opts, names, text, escaped)
+
+	switch {
+	case errors.Is(err, errReadTimeout):
+		return statusError(readStatusTimeout)
+	case errors.Is(err, io.EOF):
+		return statusError(1)
+	case err != nil:
+		fmt.Fprintf(c.stdio.Err, "read: read error: %s\n", errorReason(err))
+		return statusError(1)
+	}
+	return nil
+}
+
+// setReadMode changes the terminal for -s and -n and returns the function
+// that restores it.
+func setReadMode(fd int, opts readOptions) func() {
+	if !opts.silent && opts.nchars < 0 && opts.delim == '\n' {
+		return nil
+	}
+	old, err := tcgetattr(fd)
+	if err != nil {
+		return nil
+	}
+	t := *old
+	if opts.silent {
+		t.Lflag &^= syscall.ECHO
+	}
+	if opts.nchars >= 0 || opts.delim != '\n' {
+		// characters come as they are typed instead of by line
+		t.Lflag &^= syscall.ICANON
+		t.Cc[syscall.VMIN] = 1
+		t.Cc[syscall.VTIME] = 0
+	}
+	if tcsetattr(fd, &t) != nil {
+		return nil
+	}
+	return func() { _ = tcsetattr(fd, old) }
+}
+
+var errReadTimeout = errors.New("timed out")
+
+// inputReader reads the input of read one byte at a time, so that nothing
+// past the delimiter is taken from a file shared with other commands.
+type inputReader struct {
+	r        io.Reader
+	fd       int
+	deadline time.Time
+}
+
+func (r *inputReader) readByte() (byte, error) {
+	if !r.deadline.IsZero() && r.fd >= 0 {
+		ok, err := waitReadable(r.fd, time.Until(r.deadline))
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			return 0, errReadTimeout
+		}
+	}
+	var b [1]byte
+	for {
+		n, err := r.r.Read(b[:])
+		if n == 1 {
+			return b[0], nil
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+// readInput reads up to the delimiter or nchars characters. Without -r a
+// backslash quotes the next character and a backslash-newline is dropped.
+// escaped marks the quoted bytes of the text, they never split fields.
+func (r *inputReader) readInput(opts readOptions) (string, []bool, error) {
+	var (
+		text    []byte
+		escaped []bool
+		chars   int
+		quote   bool
+	)
+	// a multibyte character is read whole before counting stops
+	for opts.nchars < 0 || chars < opts.nchars || partialRune(text) {
+		b, err := r.readByte()
+		if err != nil {
+			return string(text), escaped, err
+		}
+
+		quoted := quote
+		quote = false
+		if quoted && b == '\n' {
+			continue
+		}
+		if !quoted {
+			if b == opts.delim {
+				break
+			}
+			if b == '\\' && !opts.raw {
+				quote = true
+				continue
+			}
+		}
+		text = append(text, b)
+		escaped = append(escaped, quoted)
+		if utf8.RuneStart(b) {
+			chars++
+		}
+	}
+	return string(text), escaped, nil
+}
+
+// partialRune reports whether text ends in the middle of a character.
+func partialRune(text []byte) bool {
+	i := len(text) - 1
+	for i > 0 && !utf8.RuneStart(text[i]) {
+		i--
+	}
+	return i >= 0 && !utf8.FullRune(text[i:])
+}
+
+// assignRead splits text into the variables, the last one taking what is
+// left. With no names the text goes to REPLY untouched.
+func (c *Command) assignRead(opts readOptions, names []string, text string, escaped []bool) {
+	sh := c.sh
+	ifs, ok := sh.getVar("IFS")
+	if !ok {
+		ifs = " \t\n"
+	}
+
+	if opts.array != "" {
+		sh.setArray(opts.array, splitRead(text, escaped, ifs, -1))
+		return
+	}
+	if len(names) == 0 {
+		sh.setVar("REPLY", text)
+		return
+	}
+
+	fields := splitRead(text, escaped, ifs, len(names))
+	for i, name := range names {
+		value := ""
+		if i < len(fields) {
+			value = fields[i]
+		}
+		sh.setVar(name, value)
+	}
+}
+
+// splitRead splits text into at most n fields on the unescaped characters
+// of ifs, the last field keeping the rest of the text. Whitespace in ifs is
+// trimmed around fields, other characters each end one. n < 0 splits it
+// all.
+func splitRead(text string, escaped []bool, ifs string, n int) []string {
+	isIFS := func(i int) bool {
+		return !escaped[i] && strings.IndexByte(ifs, text[i]) >= 0
+	}
+	isSpace := func(i int) bool {
+		return isIFS(i) && strings.IndexByte(" \t\n", text[i]) >= 0
+	}
+
+	i := 0
+	for i < len(text) && isSpace(i) {
+		i++
+	}
+	end := len(text)
+	for end > i && isSpace(end-1) {
+		end--
+	}
+
+	var fields []string
+	for i < end {
+		if n >= 0 && len(fields) == n-1 {
+			fields = append(fields, text[i:end])
+			break
+		}
+		start := i
+		for i < end && !isIFS(i) {
+			i++
+		}
+		fields = append(fields, text[start:i])
+
+		// the separator: whitespace around at most one other character
+		for i < end && isSpace(i) {
+			i++
+		}
+		if i < end && isIFS(i) {
+			i++
+			for i < end && isSpace(i) {
+				i++
+			}
+		}
+	}
+	return fields
+}
@@ -0,0 +1,376 @@
+package shell
+
+import "strings"
+
+type Scanner struct {
+	input string
+	pos   int
+	cur   rune
+	line  int
+
+	// incomplete is set when the input ends inside a quote or after a
+	// trailing backslash, the caller should read another line.
+	incomplete bool
+
+	// cond is set between `[[` and `]]`, where `<` and `>` are comparison
+	// operators and the right side of `=~` is a regular expression.
+	cond bool
+}
+
+func NewScanner(input string) *Scanner {
+	scanner := &Scanner{
+		input: input,
+		pos:   0,
+		cur:   0, // rune=0 null unicode
+		line:  1,
+	}
+	if len(input) > 0 {
+		scanner.cur = rune(input[0])
+	}
+	return scanner
+}
+
+func (sc *Scanner) Scan() []Token {
+	var res []Token
+
+	// each pass of the loop scans at most one token, starting on line
+	n, line := 0, sc.line
+	setLines := func() {
+		for ; n < len(res); n++ {
+			res[n].Line = line
+		}
+		line = sc.line
+	}
+
+	for sc.cur != 0 {
+		setLines()
+
+		if sc.cond && sc.scanCond(&res) {
+			continue
+		}
+
+		switch sc.cur {
+		case ' ', '\t':
+			sc.advance()
+		case '\n':
+			res = append(res, NewToken(TokenNewline, "\n"))
+			sc.advance()
+		case '#': // comment runs to the end of the line
+			for sc.cur != 0 && sc.cur != '\n' {
+				sc.advance()
+			}
+		case '>': // redirect out
+			if sc.peek() == '>' {
+				res = append(res, NewToken(TokenRedirectOutAppend, ">>"))
+				sc.advance()
+				sc.advance()
+			} else if sc.peek() == '|' {
+				// overrides noclobber
+				res = append(res, NewToken(TokenRedirectOut, ">|"))
+				sc.advance()
+				sc.advance()
+			} else {
+				res = append(res, NewToken(TokenRedirectOut, ">"))
+				sc.advance()
+			}
+		case '<': // redirect in
+			res = append(res, NewToken(TokenRedirectIn, "<"))
+			sc.advance()
+		case '1': // redirect out
+			if sc.peek() == '>' {
+				sc.advance()
+				if sc.peek() == '>' {
+					res = append(res, NewToken(TokenRedirectOutAppend, "1>>"))
+					sc.advance()
+					sc.advance()
+				} else if sc.peek() == '|' {
+					res = append(res, NewToken(TokenRedirectOut, "1>|"))
+					sc.advance()
+					sc.advance()
+				} else {
+					res = append(res, NewToken(TokenRedirectOut, "1>"))
+					sc.advance()
+				}
+			} else {
+				res = append(res, sc.scanWord())
+			}
+		case '2': // redirect err
+			if sc.peek() == '>' {
+				sc.advance()
+				if sc.peek() == '>' {
+					res = append(res, NewToken(TokenRedirectErrAppend, "2>>"))
+					sc.advance()
+					sc.advance()
+				} else if sc.peek() == '|' {
+					res = append(res, NewToken(TokenRedirectErr, "2>|"))
+					sc.advance()
+					sc.advance()
+				} else {
+					res = append(res, NewToken(TokenRedirectErr, "2>"))
+					sc.advance()
+				}
+			} else {
+				res = append(res, sc.scanWord())
+			}
+		case '|':
+			if sc.peek() == '|' {
+				res = append(res, NewToken(TokenOr, "||"))
+				sc.advance()
+			} else {
+				res = append(res, NewToken(TokenPipeline, "|"))
+			}
+			sc.advance()
+		case '&':
+			if sc.peek() == '&' {
+				res = append(res, NewToken(TokenAnd, "&&"))
+				sc.advance()
+			} else {
+				res = append(res, NewToken(TokenBackground, "&"))
+			}
+			sc.advance()
+		case ';':
+			switch {
+			case strings.HasPrefix(sc.input[sc.pos:], ";;&"):
+				res = append(res, NewToken(TokenDSemiAnd, ";;&"))
+				sc.advance()
+				sc.advance()
+			case sc.peek() == ';':
+				res = append(res, NewToken(TokenDSemi, ";;"))
+				sc.advance()
+			case sc.peek() == '&':
+				res = append(res, NewToken(TokenSemiAnd, ";&"))
+				sc.advance()
+			default:
+				res = append(res, NewToken(TokenSemicolon, ";"))
+			}
+			sc.advance()
+		case '(':
+			res = append(res, NewToken(TokenLParen, "("))
+			sc.advance()
+		case ')':
+			res = append(res, NewToken(TokenRParen, ")"))
+			sc.advance()
+		default:
+			tok := sc.scanWord()
+			if tok.Raw == "[[" && atCommandStart(res) {
+				sc.cond = true
+			}
+			res = append(res, tok)
+		}
+	}
+	setLines()
+
+	return res
+}
+
+// scanCond scans the tokens that are lexed differently inside [[ ]] and
+// reports whether it consumed anything.
+func (sc *Scanner) scanCond(res *[]Token) bool {
+	switch sc.cur {
+	case '<', '>':
+		*res = append(*res, NewWordToken(string(sc.cur), string(sc.cur)))
+		sc.advance()
+		return true
+	case ' ', '\t', '\n', '(', ')', '&', '|':
+		return false
+	}
+
+	var tok Token
+	if n := len(*res); n > 0 && (*res)[n-1].IsReserved("=~") {
+		tok = sc.scanRegex()
+	} else {
+		tok = sc.scanWord()
+	}
+	if tok.IsReserved("]]") {
+		sc.cond = false
+	}
+	*res = append(*res, tok)
+	return true
+}
+
+// scanRegex scans the right side of `=~`, in which parentheses and `|` are
+// part of the word as long as they are not inside quotes.
+func (sc *Scanner) scanRegex() Token {
+	var (
+		sb    strings.Builder
+		depth int
+		quote rune
+	)
+
+	start := sc.pos
+	for sc.cur != 0 {
+		if quote != 0 {
+			if sc.cur == quote {
+				quote = 0
+			} else {
+				sb.WriteByte(byte(sc.cur))
+			}
+			sc.advance()
+			continue
+		}
+
+		switch sc.cur {
+		case '\\':
+			sc.advance()
+			if sc.cur != 0 {
+				sb.WriteByte(byte(sc.cur))
+				sc.advance()
+			}
+			continue
+		case '\'', '"':
+			quote = sc.cur
+			sc.advance()
+			continue
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				return NewWordToken(sb.String(), sc.input[start:sc.pos])
+			}
+			depth--
+		case ' ', '\t', '\n':
+			if depth == 0 {
+				return NewWordToken(sb.String(), sc.input[start:sc.pos])
+			}
+		}
+		sb.WriteByte(byte(sc.cur))
+		sc.advance()
+	}
+
+	if quote != 0 {
+		sc.incomplete = true
+	}
+	return NewWordToken(sb.String(), sc.input[start:sc.pos])
+}
+
+// atCommandStart reports whether the next word is in command position, it
+// is used to tell the `[[` keyword from an argument.
+func atCommandStart(res []Token) bool {
+	if len(res) == 0 {
+		return true
+	}
+	last := res[len(res)-1]
+	switch last.Type {
+	case TokenWord:
+		return last.IsReserved("!") || last.IsReserved("{")
+	case TokenRedirectOut, TokenRedirectOutAppend, TokenRedirectErr, TokenRedirectErrAppend, TokenRedirectIn:
+		return false
+	}
+	return true
+}
+
+// Incomplete reports whether the input stopped inside a quoted string or
+// right after a line continuation.
+func (sc *Scanner) Incomplete() bool {
+	return sc.incomplete
+}
+
+func (sc *Scanner) scanWord() Token {
+	var (
+		sb            strings.Builder
+		isSingleQuote bool
+		isDoubleQuote bool
+		isEscaped     bool
+		braceDepth    int
+	)
+
+	start := sc.pos
+
+	for sc.cur != 0 {
+
+		if isEscaped {
+			isEscaped = false
+			if sc.cur == '\n' {
+				// line continuation
+				sc.advance()
+				continue
+			}
+			if isDoubleQuote && sc.cur != '"' && sc.cur != '\\' {
+				sb.WriteByte('\\')
+				sb.WriteByte(byte(sc.cur))
+			} else {
+				sb.WriteByte(byte(sc.cur))
+			}
+			sc.advance()
+			continue
+		}
+
+		if sc.cur == '\\' && !isSingleQuote {
+			isEscaped = true
+			sc.advance()
+			continue
+		}
+
+		if sc.cur == '\'' && !isDoubleQuote {
+			isSingleQuote = !isSingleQuote
+			sc.advance()
+			continue
+		}
+
+		if sc.cur == '"' && !isSingleQuote {
+			isDoubleQuote = !isDoubleQuote
+			sc.advance()
+			continue
+		}
+
+		if !isSingleQuote {
+			// keep ${...} in one word even if it holds blanks or operators
+			if sc.cur == '$' && sc.peek() == '{' {
+				braceDepth++
+				sb.WriteString("${")
+				sc.advance()
+				sc.advance()
+				continue
+			}
+			if sc.cur == '}' && braceDepth > 0 {
+				braceDepth--
+			}
+		}
+
+		if !isSingleQuote && !isDoubleQuote && braceDepth == 0 {
+			if isMetaChar(sc.cur) {
+				break
+			}
+		}
+
+		sb.WriteByte(byte(sc.cur))
+		sc.advance()
+	}
+
+	if isSingleQuote || isDoubleQuote || isEscaped || braceDepth > 0 {
+		sc.incomplete = true
+	}
+
+	return NewWordToken(sb.String(), sc.input[start:sc.pos])
+}
+
+// isMetaChar reports whether r ends an unquoted word.
+func isMetaChar(r rune) bool {
+	switch r {
+	case ' ', '\t', '\n', ';', '&', '|', '<', '>', '(', ')':
+		return true
+	}
+	return false
+}
+
+func (sc *Scanner) advance() {
+	if sc.cur == '\n' {
+		sc.line++
+	}
+	sc.pos += 1
+
+	if sc.pos >= len(sc.input) {
+		// reach end, reset to rune=0
+		sc.cur = 0
+	} else {
+		sc.cur = rune(sc.input[sc.pos])
+	}
+}
+
+func (sc *Scanner) peek() rune {
+	if sc.pos+1 >= len(sc.input) {
+		// reach end, returns 0
+		return 0
+	}
+	return rune(sc.input[sc.pos+1])
+}
@@ -0,0 +1,575 @@
+package shell
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/chzyer/readline"
+	"github.com/codecrafters-io/shell-starter-go/internal"
+)
+
+const (
+	// prompt and prompt2 are shown when PS1 and PS2 are not set, prompt2
+	// while a command continues on the next line.
+	prompt  = "$ "
+	prompt2 = "> "
+)
+
+type Shell struct {
+	historyList       []string
+	appendHistoryList []string
+
+	vars       map[string]*Variable
+	args       []string
+	name       string
+	lastStatus int
+	// lastSignal is the signal that killed the last pipeline, if one did.
+	lastSignal syscall.Signal
+	// started is when the shell started, for printf's %(fmt)T.
+	started time.Time
+
+	funcs  map[string]*FuncDef
+	frames []*callFrame
+	// aliases maps the names of aliases to their values.
+	aliases map[string]string
+
+	// sources are the files commands are read from, the innermost last,
+	// sourced counts the ones run by `source`. lineno is the line of the
+	// command running, for LINENO and error messages.
+	sources []string
+	sourced int
+	lineno  int
+	// inputName is named in the error messages of the commands the shell
+	// reads from its input when it is not interactive.
+	inputName string
+
+	// login, rcFile and noRC are from Config, for RunStartup.
+	login  bool
+	rcFile string
+	noRC   bool
+
+	// builtins is shared with subshells, ctx is passed to the builtins.
+	builtins *Registry
+	ctx      context.Context
+
+	jobs *jobTable
+	// job is the job whose processes are being started, the foreground
+	// pipeline or, on the copy of the shell that runs it, a background job.
+	job *Job
+
+	// jobControl is on for an interactive shell, which then runs each job
+	// in its own process group on the terminal tty.
+	jobControl bool
+	tty        int
+	pgid       int
+	term       *readline.State
+
+	// traps maps a condition such as "EXIT" or "INT" to its action, signals
+	// receives the trapped signals. Only the main shell has the channel.
+	traps   map[string]string
+	signals chan os.Signal
+	inTrap  bool
+
+	// opts holds the options of set and shopt.
+	opts Options
+	// checking is non-zero while running commands whose failure is tested,
+	// like the left side of && and ||.
+	checking int
+
+	// dir is the logical working directory, PWD follows it. Programs start
+	// in it and relative paths are resolved against it.
+	dir string
+	// dirStack holds the directories of pushd below the working directory,
+	// the most recent first.
+	dirStack []string
+	// hash remembers where the programs that ran were found in PATH, it is
+	// cleared when PATH changes.
+	hash map[string]hashEntry
+	// trackDirs records the directories cd goes to in the z database, it
+	// is on in an interactive shell.
+	trackDirs bool
+	// interactive is set for a shell reading commands from a user, errors
+	// that end a script only fail the command there.
+	interactive bool
+
+	// stdio is what the shell was given in Config, files are the files
+	// connected to it while Eval runs.
+	stdio Stdio
+	files ioFiles
+	// stdin is the read end of the pipe fed from stdio.In when it is not
+	// a file. It is made once and kept, so input one Eval leaves unread
+	// is there for the next.
+	stdin *os.File
+}
+
+// Config sets up a shell made with New. The zero value gives a shell on
+// the process's standard files and environment.
+type Config struct {
+	// Stdin, Stdout and Stderr default to the process's. Streams that are
+	// not *os.File are connected through pipes while Eval runs.
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// Env holds the initial variables in NAME=value form, all exported.
+	// It defaults to os.Environ().
+	Env []string
+
+	// Dir is the directory the shell starts in, the current one if empty.
+	Dir string
+
+	// Builtins defaults to DefaultRegistry(). The shell uses the registry
+	// as is, so builtins can still be added to it after New.
+	Builtins *Registry
+
+	// Name is $0 and Args the positional parameters.
+	Name string
+	Args []string
+
+	// Options are the options the shell starts with, such as OptNoexec
+	// for a syntax check.
+	Options Options
+
+	// Login makes a login shell, RCFile replaces ~/.myshellrc and NoRC
+	// skips it. They choose the files RunStartup runs.
+	Login  bool
+	RCFile string
+	NoRC   bool
+}
+
+func New(cfg Config) *Shell {
+	builtins := cfg.Builtins
+	if builtins == nil {
+		builtins = DefaultRegistry()
+	}
+	name := cfg.Name
+	if name == "" {
+		name = os.Args[0]
+	}
+	env := cfg.Env
+	if env == nil {
+		env = os.Environ()
+	}
+
+	sh := &Shell{
+		name:     name,
+		started:  time.Now(),
+		args:     cfg.Args,
+		funcs:    make(map[string]*FuncDef),
+		aliases:  make(map[string]string),
+		hash:     make(map[string]hashEntry),
+		builtins: builtins,
+		ctx:      context.Background(),
+		jobs:     &jobTable{},
+		traps:    make(map[string]string),
+		// buffered so signals arriving during a long command are not lost
+		signals: make(chan os.Signal, 16),
+		stdio:   Stdio{In: os.Stdin, Out: os.Stdout, Err: os.Stderr},
+	}
+	if cfg.Stdin != nil {
+		sh.stdio.In = cfg.Stdin
+	}
+	if cfg.Stdout != nil {
+		sh.stdio.Out = cfg.Stdout
+	}
+	if cfg.Stderr != nil {
+		sh.stdio.Err = cfg.Stderr
+	}
+	sh.files = stdFiles()
+	sh.opts = cfg.Options
+	sh.login, sh.rcFile, sh.noRC = cfg.Login, cfg.RCFile, cfg.NoRC
+	sh.initVars(env)
+
+	if err := sh.initDir(cfg.Dir); err != nil {
+		fmt.Fprintf(sh.stdio.Err, "%s\n", err)
+	}
+
+	return sh
+}
+
+// Run reads and runs commands from the shell's standard input with a line
+// editor until exit or the end of input.
+func (sh *Shell) Run() {
+	// the line editor reads and writes the same streams as the commands
+	files, closeFiles, err := sh.openStdio()
+	if err != nil {
+		log.Fatal(err)
+	}
+	saved := sh.files
+	sh.files = files
+	defer func() {
+		sh.files = saved
+		closeFiles()
+	}()
+
+	rl, err := readline.NewEx(&readline.Config{
+		Prompt:       sh.prompt1(),
+		HistoryFile:  "/tmp/my-shell.history",
+		AutoComplete: NewMyAutoCompleter(sh.builtins, sh.aliases, sh.getVar, sh.prompt1, files.stdout),
+		Stdin:        readline.NewCancelableStdin(files.stdin),
+		Stdout:       files.stdout,
+		Stderr:       files.stderr,
+		// readline would suspend the shell and its parent on Ctrl-Z, an
+		// interactive shell ignores it at the prompt
+		FuncFilterInputRune: func(r rune) (rune, bool) {
+			return r, r != readline.CharCtrlZ
+		},
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer rl.Close()
+
+	sh.initJobControl()
+	sh.trackDirs = true
+	sh.interactive = true
+
+	historyFile := os.Getenv("HISTFILE")
+	if historyFile != "" {
+		err := sh.readHistory(historyFile)
+		if err != nil {
+			fmt.Fprintf(files.stderr, "%s\n", err)
+			return
+		}
+		defer func() {
+			sh.dumpHistory(historyFile)
+		}()
+	}
+
+	var pending string
+	for {
+
+		if pending == "" {
+			// PS1 may have changed
+			rl.SetPrompt(sh.prompt1())
+			sh.reportJobs(files.stderr)
+			if errors.Is(sh.runPendingTraps(files), ErrExit) {
+				break
+			}
+		}
+
+		input, err := rl.Readline()
+		if errors.Is(err, readline.ErrInterrupt) {
+			// Ctrl-C drops the line, and whatever was continued before it
+			pending = ""
+			sh.lastStatus = 130
+			continue
+		}
+		if errors.Is(err, io.EOF) {
+			// Ctrl-D exits, like the exit builtin
+			fmt.Fprintln(files.stderr, "exit")
+			break
+		}
+		if err != nil {
+			fmt.Fprintln(files.stderr, err)
+			sh.runExitTrap(files)
+			closeFiles()
+			os.Exit(1)
+		}
+
+		input = strings.Trim(input, "\n\r")
+		if pending != "" {
+			input = pending + "\n" + input
+		}
+
+		prog, err := sh.parse(input)
+		if errors.Is(err, errIncomplete) {
+			pending = input
+			rl.SetPrompt(sh.prompt2())
+			continue
+		}
+		pending = ""
+
+		sh.appendHistory(input)
+
+		if err != nil {
+			fmt.Fprintf(files.stderr, "%s\n", err)
+			sh.lastStatus = 2
+			continue
+		}
+
+		err = sh.runList(prog, files)
+		if errors.Is(err, ErrExit) {
+			break
+		}
+	}
+
+	sh.runExitTrap(files)
+}
+
+// prompt1 is the prompt for a new command, PS1 if it is set.
+func (sh *Shell) prompt1() string {
+	if ps1, ok := sh.getVar("PS1"); ok {
+		return ps1
+	}
+	return prompt
+}
+
+// prompt2 is the prompt for the next line of a command, PS2 if it is set.
+func (sh *Shell) prompt2() string {
+	if ps2, ok := sh.getVar("PS2"); ok {
+		return ps2
+	}
+	return prompt2
+}
+
+// subshell returns a copy of the shell whose variables, functions, options
+// and positional parameters can change without affecting sh.
+func (sh *Shell) subshell() *Shell {
+	sub := *sh
+
+	sub.vars = make(map[string]*Variable, len(sh.vars))
+	for name, v := range sh.vars {
+		copied := *v
+		sub.vars[name] = &copied
+	}
+
+	sub.funcs = make(map[string]*FuncDef, len(sh.funcs))
+	for name, fn := range sh.funcs {
+		sub.funcs[name] = fn
+	}
+
+	sub.aliases = maps.Clone(sh.aliases)
+	sub.hash = maps.Clone(sh.hash)
+
+	// frames are only read by the copy, but popping must not touch the
+	// parent's slice
+	sub.frames = append([]*callFrame(nil), sh.frames...)
+
+	sub.jobs = &jobTable{lastPid: sh.jobs.lastPid}
+
+	// a subshell keeps the signals ignored by its parent, other traps are
+	// reset
+	sub.traps = make(map[string]string)
+	for name, action := range sh.traps {
+		if action == "" {
+			sub.traps[name] = action
+		}
+	}
+	sub.signals = nil
+
+	return &sub
+}
+
+func (sh *Shell) appendHistory(input string) {
+	sh.historyList = append(sh.historyList, input)
+	sh.appendHistoryList = append(sh.appendHistoryList, input)
+}
+
+func (sh *Shell) readHistory(path string) error {
+	historyFile, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer historyFile.Close()
+	reader := bufio.NewReader(historyFile)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return err
+		}
+
+		line = strings.TrimSpace(line)
+
+		if len(line) == 0 {
+			continue
+		}
+
+		sh.historyList = append(sh.historyList, line)
+	}
+	return nil
+}
+
+func (sh *Shell) dumpHistory(path string) error {
+	historyFile, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer historyFile.Close()
+	for _, history := range sh.historyList {
+		fmt.Fprintf(historyFile, "%s\n", history)
+	}
+	return nil
+}
+
+type myAutoCompleter struct {
+	trie *internal.Trie
+	// builtins and aliases are read on each completion, so those added
+	// after the shell was created are completed too.
+	builtins *Registry
+	aliases  map[string]string
+	getVar   func(string) (string, bool)
+	// prompt returns the prompt, which is printed again after a list of
+	// candidates.
+	prompt func() string
+	// out is the terminal the candidates are listed on.
+	out io.Writer
+
+	tabPressed bool
+}
+
+func NewMyAutoCompleter(builtins *Registry, aliases map[string]string, getVar func(string) (string, bool), prompt func() string, out io.Writer) readline.AutoCompleter {
+	trie := internal.NewTrie()
+
+	for _, cmd := range getExternCommand() {
+		trie.Insert(cmd)
+	}
+
+	//trie.Insert("xyz_ant")
+	//trie.Insert("xyz_ant_owl")
+	//trie.Insert("xyz_ant_owl_pig")
+
+	//trie.Print()
+
+	return &myAutoCompleter{
+		trie:     trie,
+		builtins: builtins,
+		aliases:  aliases,
+		getVar:   getVar,
+		prompt:   prompt,
+		out:      out,
+	}
+}
+
+func (m *myAutoCompleter) Do(line []rune, pos int) (newLine [][]rune, length int) {
+	strLine := string(line)
+	l := strings.Fields(strLine)
+	if len(l) == 0 {
+		return nil, 0
+	}
+
+	if len(l) > 1 || strings.HasSuffix(strLine, " ") {
+		return m.completeArgs(l, strLine)
+	}
+
+	prefix := l[0]
+	completion := m.trie.FindCompletion(prefix)
+	for _, name := range append(m.builtins.Names(), sortedKeys(m.aliases)...) {
+		if strings.HasPrefix(name, prefix) && !m.trie.Search(name) && !slices.Contains(completion, name) {
+			completion = append(completion, name)
+		}
+	}
+
+	if len(completion) == 0 {
+		m.tabPressed = false
+		fmt.Fprintf(m.out, "\x07")
+		return nil, 0
+	} else if len(completion) == 1 {
+		// 直接补全需要依赖readline
+		m.tabPressed = false
+		strCompletion0 := completion[0]
+		strCompletion0, _ = strings.CutPrefix(strCompletion0, prefix)
+		strCompletion0 += " "
+		return [][]rune{[]rune(strCompletion0)}, len(prefix)
+	} else {
+		sort.Slice(completion, func(i, j int) bool {
+			return len(completion[i]) < len(completion[j])
+		})
+		isChain := isCompletionPrefixChain(completion)
+		if isChain {
+			strCompletion0 := completion[0]
+			strCompletion0, _ = strings.CutPrefix(strCompletion0, prefix)
+			return [][]rune{[]rune(strCompletion0)}, len(prefix)
+		} else if !m.tabPressed {
+			m.tabPressed = true
+			fmt.Fprintf(m.out, "\x07")
+			return nil, 0
+		} else {
+			// 为了通过测试需要手动输出到stdout
+			m.tabPressed = false
+			sort.Strings(completion)
+			fmt.Fprintf(m.out, "\n%s\n", strings.Join(completion, "  "))
+			fmt.Fprintf(m.out, "%s%s", m.prompt(), strLine)
+			return nil, 0
+		}
+	}
+}
+
+// completeArgs completes the last word of a builtin's arguments with the
+// candidates of its completion hook.
+func (m *myAutoCompleter) completeArgs(words []string, line string) ([][]rune, int) {
+	b, ok := m.builtins.Lookup(words[0])
+	if !ok {
+		return nil, 0
+	}
+	args := words[1:]
+	if strings.HasSuffix(line, " ") {
+		args = append(args, "")
+	}
+	last := args[len(args)-1]
+
+	var cands []string
+	if vc, ok := b.(varCompleter); ok {
+		cands = vc.completeWith(m.getVar, args)
+	} else {
+		cands = b.Complete(args)
+	}
+	var res [][]rune
+	for _, cand := range cands {
+		if !strings.HasPrefix(cand, last) {
+			continue
+		}
+		res = append(res, []rune(cand[len(last):]+" "))
+	}
+	if len(res) == 0 && len(cands) > 0 {
+		// readline only inserts text, candidates that replace the word
+		// are listed instead
+		fmt.Fprintf(m.out, "\n%s\n", strings.Join(cands, "  "))
+		fmt.Fprintf(m.out, "%s%s", m.prompt(), line)
+	}
+	return res, len(last)
+}
+
+func isCompletionPrefixChain(strs []string) bool {
+	for i := 0; i < len(strs)-1; i++ {
+		cur := strs[i]
+		next := strs[i+1]
+
+		ok := strings.HasPrefix(next, cur)
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func getExternCommand() []string {
+	var cmds []string
+
+	path := os.Getenv("PATH")
+	for _, dir := range filepath.SplitList(path) {
+		if dir == "" {
+			// Unix shell semantics: path element "" means "."
+			dir = "."
+		}
+		_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if path == dir {
+				return nil
+			}
+
+			r, err := filepath.Rel(dir, path)
+			if err != nil {
+				return nil
+			}
+			cmds = append(cmds, r)
+			return nil
+		})
+	}
+	return cmds
+}
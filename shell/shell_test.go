@@ -0,0 +1,613 @@
+package shell
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// runScript runs src in a fresh shell and returns what it wrote to stdout.
+func runScript(t *testing.T, src string) string {
+	t.Helper()
+	return runIn(t, New(Config{}), src)
+}
+
+// runIn runs src in sh and returns what it wrote to stdout.
+func runIn(t *testing.T, sh *Shell, src string) string {
+	t.Helper()
+
+	p, err := sh.newParser(src, 1)
+	if err != nil {
+		t.Fatalf("parse %q: %v", src, err)
+	}
+
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(pr)
+		out <- string(b)
+	}()
+
+	err = sh.runLines(p, ioFiles{stdin: os.Stdin, stdout: pw, stderr: os.Stderr})
+	pw.Close()
+	got := <-out
+	var syntaxErr *syntaxError
+	if errors.As(err, &syntaxErr) || errors.Is(err, errIncomplete) {
+		t.Fatalf("parse %q: %v", src, err)
+	}
+	return got
+}
+
+func TestCase(t *testing.T) {
+	got := runScript(t, `x=Stop
+case $x in start|stop) echo lower;; S*) echo upper;& z) echo fell;;& *) echo any;; esac
+shopt -s nocasematch
+case $x in start|stop) echo matched;; esac
+case ab in "a*") echo bad;; *) echo ok;; esac`)
+	want := "upper\nfell\nany\nmatched\nok\n"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestExpandQuotedAdjacent(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"ab", "ac", "b"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got := runScript(t, `d=`+dir+`
+echo "a"b 'c'd "e"'f'g
+echo "$d"/a*
+echo "$d/"?
+echo "$d"/"a"*
+echo "$d"/"a*"
+case ab in "a"*) echo match;; *) echo none;; esac`)
+	want := "ab cd efg\n" +
+		dir + "/ab " + dir + "/ac\n" +
+		dir + "/b\n" +
+		dir + "/ab " + dir + "/ac\n" +
+		dir + "/a*\n" +
+		"match\n"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestFunction(t *testing.T) {
+	got := runScript(t, `f() { echo "$FUNCNAME $# $2"; local x=in; echo $x; return 3; }
+x=out
+f a "b c"
+echo $? $x
+function down { case $1 in 0) echo end;; *) echo $1; down ${2:-0};; esac; }
+down 1`)
+	want := "f 2 b c\nin\n3 out\n1\nend\n"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestSubshellAndGroup(t *testing.T) {
+	dir := t.TempDir()
+	got := runScript(t, `x=1
+(x=2; cd /; exit 4)
+echo $? $x
+{ echo a; echo b; } > `+dir+`/out
+{ echo grouped; } | cat
+(echo c; echo d) | cat
+echo $x`)
+	want := "4 1\ngrouped\nc\nd\n1\n"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	b, err := os.ReadFile(dir + "/out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "a\nb\n" {
+		t.Errorf("redirected group wrote %q", b)
+	}
+}
+
+func TestCondCommand(t *testing.T) {
+	got := runScript(t, `x="hello world"
+[[ $x == hello* ]] && echo glob
+[[ $x == "hello*" ]] || echo literal
+[[ $x =~ ^(hel+)o\ (w.*)$ ]] && echo "${BASH_REMATCH[1]} ${BASH_REMATCH[2]} ${#BASH_REMATCH[@]}"
+[[ abc =~ "a.c" ]] || echo quoted-regex
+[[ -z "" && -n $x && ! -f / ]] && echo tests
+[[ ( 1 -eq 2 || 3 -ge 3 ) && b > a ]] && echo grouped
+[[ 1 -eq x ]]
+echo $?`)
+	want := "glob\nliteral\nhell world 3\nquoted-regex\ntests\ngrouped\n2\n"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestBackgroundJobs(t *testing.T) {
+	got := runScript(t, `(exit 3) &
+wait $!
+echo $?
+sleep 0.1 && echo slept &
+jobs %sleep > /dev/null && echo found
+wait %1
+echo $?
+true &
+wait
+jobs
+wait %5
+echo $?`)
+	want := "3\nfound\nslept\n0\n127\n"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestJobSignalReport(t *testing.T) {
+	sh := New(Config{})
+	runIn(t, sh, `sh -c 'exit 137' &
+sh -c 'kill -KILL $$' &
+sh -c 'kill -TERM $$' &
+sh -c 'exit 3' &`)
+	for _, j := range sh.jobs.list() {
+		<-j.done
+	}
+
+	var sb strings.Builder
+	sh.reportJobs(&sb)
+	for _, want := range []string{
+		"Exit 137                sh -c 'exit 137'",
+		"Killed                  sh -c 'kill -KILL $$'",
+		"Terminated              sh -c 'kill -TERM $$'",
+		"Exit 3                  sh -c 'exit 3'",
+	} {
+		if !strings.Contains(sb.String(), want) {
+			t.Errorf("missing %q in:\n%s", want, sb.String())
+		}
+	}
+}
+
+func TestBackgroundBuiltins(t *testing.T) {
+	fifo := filepath.Join(t.TempDir(), "fifo")
+	if err := syscall.Mkfifo(fifo, 0o600); err != nil {
+		t.Skip(err)
+	}
+	// the job waits for the writer below, the shell must not wait for it
+	got := runScript(t, `{ read line < `+fifo+`; echo "read $line"; } &
+[ "$!" != "$$" ] && echo own pid
+echo x >> `+fifo+`
+wait $!
+echo $?`)
+	want := "own pid\nread x\n0\n"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestTrap(t *testing.T) {
+	got := runScript(t, `trap 'echo err $?' ERR
+false
+false || true
+! false
+(trap 'echo bye' EXIT; echo sub; exit 2)
+echo $?
+f() { return 4; }
+trap 'echo ret $?' RETURN
+f
+trap - RETURN ERR
+trap "echo it's" INT
+trap -p
+trap '' USR1
+trap -p USR1 INT
+trap - INT USR1
+trap -p
+trap x y
+echo $?`)
+	want := "err 1\nsub\nbye\nerr 2\n2\nret 4\nerr 4\n" +
+		"trap -- 'echo it'\\''s' SIGINT\n" +
+		"trap -- '' SIGUSR1\ntrap -- 'echo it'\\''s' SIGINT\n" +
+		"1\n"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestOptions(t *testing.T) {
+	dir := t.TempDir()
+	got := runScript(t, `false | true; echo $?
+set -o pipefail; false | true; echo $?; set +o pipefail
+set -uC; echo $-
+echo ${unset-default}; set +u
+echo 1 > `+dir+`/f; echo 2 > `+dir+`/f; echo 3 >| `+dir+`/f; cat `+dir+`/f
+set -f; echo /*; set +f
+set -- a "b c"; echo $# $2
+set -e; set +o | grep errexit
+false || echo handled
+f() { false; echo cond; }; f && true
+false
+echo unreachable`)
+	want := "0\n1\nCu\ndefault\n3\n/*\n2 b c\nset -o errexit\nhandled\ncond\n"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestNounset(t *testing.T) {
+	// an unbound variable ends a script, but only a pipeline stage in a
+	// subshell
+	sh := New(Config{})
+	got := runIn(t, sh, `set -u
+echo $unset | cat; echo $?
+(echo $unset; echo unreached); echo $?
+echo before; echo $unset; echo after`)
+	if want := "0\n1\nbefore\n"; got != want {
+		t.Errorf("script: got %q, want %q", got, want)
+	}
+	if sh.lastStatus != 1 {
+		t.Errorf("script: status %d, want 1", sh.lastStatus)
+	}
+
+	for _, src := range []string{`case $unset in *) echo unreached;; esac`, `[[ $unset ]]`, `{ echo unreached; } > $unset`} {
+		if got := runScript(t, "set -u; "+src+"\necho after"); got != "" {
+			t.Errorf("%s: got %q, want the script to end", src, got)
+		}
+	}
+
+	// an interactive shell only fails the command
+	sh = New(Config{})
+	sh.interactive = true
+	got = runIn(t, sh, `set -u; echo $unset; echo $?; echo after`)
+	if want := "1\nafter\n"; got != want {
+		t.Errorf("interactive: got %q, want %q", got, want)
+	}
+}
+
+func TestPipelineStages(t *testing.T) {
+	got := runScript(t, `yes | head -2
+x=1; x=2 | cat; echo $x
+f() { x=3; echo f; }; f | cat; echo $x
+exit 3 | cat; echo $?
+echo a | exit 4; echo $?
+false | cat; echo $?
+shopt -s lastpipe
+echo a | x=5; echo $x`)
+	want := "y\ny\n1\nf\n1\n0\n4\n0\n5\n"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestBuiltinStdio(t *testing.T) {
+	var out, errOut strings.Builder
+	c := NewCommand(New(Config{}))
+	c.stdio = Stdio{In: strings.NewReader(""), Out: &out, Err: &errOut}
+
+	c.Args = []string{"type", "echo"}
+	if err := c.execType(); err != nil {
+		t.Fatal(err)
+	}
+	c.Args = []string{"type", "nosuch-command"}
+	if err := c.execType(); exitStatus(err) != 1 {
+		t.Errorf("type of a missing command: got %v, want status 1", err)
+	}
+	c.Args = []string{"echo", "a", "b"}
+	if err := c.execEcho(); err != nil {
+		t.Fatal(err)
+	}
+	c.Args = []string{"exit", "foo"}
+	if err := c.execExit(); !errors.Is(err, ErrExit) || c.sh.lastStatus != 2 {
+		t.Errorf("exit foo: got %v, status %d", err, c.sh.lastStatus)
+	}
+
+	if want := "echo is a shell builtin\na b\n"; out.String() != want {
+		t.Errorf("stdout: got %q, want %q", out.String(), want)
+	}
+	if want := "nosuch-command: not found\nexit: foo: numeric argument required\n"; errOut.String() != want {
+		t.Errorf("stderr: got %q, want %q", errOut.String(), want)
+	}
+}
+
+func TestRedirectIn(t *testing.T) {
+	f := filepath.Join(t.TempDir(), "f")
+	got := runScript(t, `echo hello > `+f+`
+cat < `+f+`
+type echo > `+f+`; cat <`+f+`
+type nosuch-command 2>/dev/null; echo $?
+cat < `+f+`.missing 2>/dev/null; echo $?`)
+	want := "hello\necho is a shell builtin\n1\n1\n"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRegisterBuiltin(t *testing.T) {
+	sh := New(Config{})
+	sh.builtins.Register(&BuiltinFunc{
+		BuiltinName: "greet",
+		Usage:       "greet name\nSay hello.",
+		Fn: func(ctx context.Context, c *Command) error {
+			if len(c.Args) < 2 {
+				return statusError(2)
+			}
+			fmt.Fprintf(c.Stdio().Out, "hello %s\n", c.Args[1])
+			return nil
+		},
+	})
+	sh.builtins.Unregister("history")
+
+	got := runIn(t, sh, `greet world | cat
+greet; echo $?
+type greet
+type history 2>/dev/null; echo $?
+help greet`)
+	want := "hello world\n2\ngreet is a shell builtin\n1\ngreet: greet name\n    Say hello.\n"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestBuiltinComplete(t *testing.T) {
+	b, _ := DefaultRegistry().Lookup("set")
+	got := b.Complete([]string{"-o", "no"})
+	want := []string{"noclobber", "noexec", "noglob", "nounset"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestCd(t *testing.T) {
+	root := t.TempDir()
+	for _, d := range []string{"real/sub", "cdpath/proj"} {
+		if err := os.MkdirAll(filepath.Join(root, d), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(root, "real"), filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	got := runScript(t, strings.ReplaceAll(`cd R/link/sub; pwd; pwd -P
+cd ..; pwd; cd -P ..; pwd
+cd -; cd -L ../link/sub/../sub; pwd
+CDPATH=R/cdpath; cd proj; cd R/real; cd sub; pwd
+cd R/real/nosuch 2>/dev/null; echo $?
+HOME=R; cd; pwd`, "R", root))
+	got = strings.ReplaceAll(got, root, "R")
+	want := `R/link/sub
+R/real/sub
+R/link
+R
+R/link
+R/link/sub
+R/cdpath/proj
+R/real/sub
+1
+R
+`
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestDirStack(t *testing.T) {
+	got := runScript(t, `cd /tmp; pushd /usr; pushd /etc; dirs -v
+echo ~1 ~-0 ~+ ~- ~9
+pushd +2; pushd; popd +1; popd; popd 2>/dev/null; echo $?
+pushd -n /var; dirs -p; HOME=/usr; pushd /usr/lib; dirs -l; dirs -c; dirs`)
+	want := `/usr /tmp
+/etc /usr /tmp
+ 0  /etc
+ 1  /usr
+ 2  /tmp
+/usr /tmp /etc /usr ~9
+/tmp /etc /usr
+/etc /tmp /usr
+/etc /usr
+/usr
+1
+/usr /var
+/usr
+/var
+~/lib ~ /var
+/usr/lib /usr /var
+~/lib
+`
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestZ(t *testing.T) {
+	root := t.TempDir()
+	for _, d := range []string{"projects/alpha", "projects/beta", "other/alphabet"} {
+		if err := os.MkdirAll(filepath.Join(root, d), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sh := New(Config{})
+	sh.trackDirs = true
+	sh.setVar("_Z_DATA", filepath.Join(root, "z"))
+	got := runIn(t, sh, strings.ReplaceAll(`cd R/projects/alpha; cd R/other/alphabet; cd R/projects/alpha
+cd R/projects/beta; cd /
+z alp; pwd; z oth alp; pwd; z ALP; pwd
+z nomatch 2>/dev/null; echo $?
+z -l proj b`, "R", root))
+	want := strings.ReplaceAll(`R/projects/alpha
+R/other/alphabet
+R/projects/alpha
+1
+4.00       R/projects/beta
+`, "R", root)
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// completion reads the database the shell's _Z_DATA names
+	m := NewMyAutoCompleter(sh.builtins, sh.aliases, sh.getVar, sh.prompt1, io.Discard).(*myAutoCompleter)
+	line := "z " + root + "/projects/b"
+	cands, n := m.Do([]rune(line), len(line))
+	if len(cands) != 1 || string(cands[0]) != "eta " || n != len(root)+len("/projects/b") {
+		t.Errorf("completion: got %q, %d", cands, n)
+	}
+}
+
+func TestZAging(t *testing.T) {
+	entries := []zEntry{{path: "/a", rank: 8999.5, time: 1}, {path: "/b", rank: 1, time: 1}}
+	entries = addVisit(entries, "/b", 2)
+	if len(entries) != 2 || entries[0].rank != 8999.5*0.99 || entries[1].rank != 2*0.99 || entries[1].time != 2 {
+		t.Errorf("got %+v", entries)
+	}
+	entries = addVisit([]zEntry{{path: "/a", rank: 9000}, {path: "/b", rank: 1}}, "/c", 3)
+	if len(entries) != 1 || entries[0].path != "/a" {
+		t.Errorf("the entries below one were not dropped: %+v", entries)
+	}
+}
+
+func TestEchoPrintf(t *testing.T) {
+	got := runScript(t, `echo -n a; echo b; echo -e 'x\ty\0101\c' after; echo; echo -E 'a\tb' -nx
+printf '%s-%d\n' a 1 b 2 c
+printf '%5.2f|%-4s|%04d|%x|%o|%c|%%\n' 3.14159 ab 7 255 8 hello
+printf '%b|%q|%q\n' 'tab\there\c' "a b" x
+printf -v c 'a\tb\033'; printf '%q|%q|%q|%q|%q\n' "a b'c" '' '~/x:~' "$c" '#a#'
+printf '%(%Y-%m-%d %H)T\n' 86400
+printf '%()T|%(%x)T\n' 0 0
+printf '%b|%b|%b|%b\n' '\101' '\0102' '\1030' '\08'
+printf -v v '%s+%s' 1 2; echo $v
+printf '\101\x42 %*d %d\n' 3 1 \'A
+printf '%d\n' abc 2>/dev/null; echo $?`)
+	want := "ab\nx\tyA\na\\tb -nx\n" +
+		"a-1\nb-2\nc-0\n" +
+		" 3.14|ab  |0007|ff|10|h|%\n" +
+		"tab\there" +
+		`a\ b\'c|''|\~/x:\~|$'a\tb\E'|\#a#` + "\n" +
+		time.Unix(86400, 0).Format("2006-01-02 15") + "\n" +
+		time.Unix(0, 0).Format("15:04:05|01/02/06") + "\n" +
+		"A|B|C0|\x008\n" +
+		"1+2\n" +
+		"AB   1 65\n" +
+		"0\n1\n"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRead(t *testing.T) {
+	got := runScript(t, `echo '  a  b   c d  ' | { read x y; echo "[$x][$y]"; }
+echo 'root:x:0:0:root' | { IFS=: read -r user _ uid _; echo "[$user][$uid]"; }
+echo 'a\ b\\c d\
+e' | { read x y; echo "[$x][$y]"; }
+echo '  keep  ' | { read -r; echo "[$REPLY]"; }
+echo 'one two three' | { read -a arr; echo ${arr[1]} ${#arr[@]}; }
+printf 'abc;def' | { read -d ';' x; echo "[$x]"; read y; echo "[$y] $?"; }
+echo 'héllo' | { read -n 2 x; echo "[$x]"; }
+sleep 1 | { read -t 0.1 x; echo $?; }
+echo 'a::b' | { IFS=: read x y z; echo "[$x][$y][$z]"; }`)
+	want := `[a][b   c d]
+[root][0]
+[a b\c][de]
+[  keep  ]
+two 3
+[abc]
+[def] 1
+[hé]
+142
+[a][][b]
+`
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestTypeCommandHash(t *testing.T) {
+	dir := t.TempDir()
+	prog := filepath.Join(dir, "prog")
+	if err := os.WriteFile(prog, []byte("#!/bin/sh\necho prog\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	got := runScript(t, `PATH=`+dir+`
+f() { echo fn; }
+type -t f echo prog case nosuch; echo $?
+type prog; type -p prog echo
+echo() { printf 'fn echo\n'; }
+echo a; builtin echo b; command echo c
+command -v f prog cd; command -V cd
+prog; prog; hash
+hash -t prog; hash -d prog; hash -t prog; builtin echo $?
+hash -p /bin/x prog; hash -l; PATH=$PATH; hash`)
+	want := fmt.Sprintf(`function
+builtin
+file
+keyword
+1
+prog is %[1]s
+%[1]s
+fn echo
+b
+c
+f
+%[1]s
+cd
+cd is a shell builtin
+prog
+prog
+hits	command
+   2	%[1]s
+%[1]s
+1
+builtin hash -p /bin/x prog
+`, prog)
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestAlias(t *testing.T) {
+	got := runScript(t, `alias say='echo said:' e='echo ' hi=hello hello='echo HELLO'
+alias loop1=loop2 loop2=loop1 g='{ echo grp; }'
+say a b
+e hi
+hi; \hi 2>/dev/null; 'hi' 2>/dev/null; echo $?
+loop1 2>/dev/null; echo $?
+x=1 say after
+g
+alias say; type say; type -t say; command -v say
+alias hi=x; unalias hi; say same line
+say next line
+alias a/b=x 2>/dev/null; echo $?
+unalias -a; alias; echo done`)
+	want := `said: a b
+echo HELLO
+HELLO
+127
+127
+said: after
+grp
+alias say='echo said:'
+say is aliased to ` + "`echo said:'" + `
+alias
+alias say='echo said:'
+said: same line
+said: next line
+1
+done
+`
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
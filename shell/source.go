@@ -0,0 +1,160 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// pushSource records that commands are read from file until the returned
+// function is called. BASH_SOURCE lists the files, the current one first.
+func (sh *Shell) pushSource(file string) (pop func()) {
+	sh.sources = append(sh.sources, file)
+	sh.setSourceVar()
+	return func() {
+		sh.sources = sh.sources[:len(sh.sources)-1]
+		sh.setSourceVar()
+	}
+}
+
+func (sh *Shell) setSourceVar() {
+	if len(sh.sources) == 0 {
+		sh.unsetVar("BASH_SOURCE")
+		return
+	}
+	files := slices.Clone(sh.sources)
+	slices.Reverse(files)
+	sh.setArray("BASH_SOURCE", files)
+}
+
+// errorPrefix is put before the error messages of commands read from a
+// file, to tell where they are.
+func (sh *Shell) errorPrefix() string {
+	name := sh.inputName
+	if len(sh.sources) > 0 {
+		name = sh.sources[len(sh.sources)-1]
+	}
+	if name == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s: line %d: ", name, sh.lineno)
+}
+
+// sourceError adds the file and line to a syntax error met in file.
+func sourceError(file string, line int, err error) error {
+	return fmt.Errorf("%s: line %d: %w", file, line, err)
+}
+
+// runSource runs the commands of src, read from file, in the shell. A syntax
+// error is returned with its file and line.
+func (sh *Shell) runSource(file, src string, files ioFiles) error {
+	defer sh.pushSource(file)()
+
+	p, err := sh.newParser(src, 1)
+	if err != nil {
+		sh.lastStatus = 2
+		return sourceError(file, strings.Count(src, "\n")+1, err)
+	}
+	err = sh.runLines(p, files)
+	var syntaxErr *syntaxError
+	if errors.As(err, &syntaxErr) || errors.Is(err, errIncomplete) {
+		return sourceError(file, p.line(), err)
+	}
+	return err
+}
+
+// findSource finds the file for `source name`. A name without a slash is
+// looked for in PATH, the file need not be executable, and then in the
+// working directory.
+func (sh *Shell) findSource(name string) string {
+	if strings.Contains(name, "/") {
+		return name
+	}
+	path, _ := sh.getVar("PATH")
+	for _, dir := range filepath.SplitList(path) {
+		if dir == "" {
+			dir = "."
+		}
+		file := dir + "/" + name
+		if fi, err := os.Stat(sh.abs(file)); err == nil && fi.Mode().IsRegular() {
+			return file
+		}
+	}
+	return name
+}
+
+func (c *Command) execSource() error {
+	args := c.Args[1:]
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		fmt.Fprintf(c.stdio.Err, "%s: filename argument required\n", c.Args[0])
+		fmt.Fprintf(c.stdio.Err, "%s: usage: %s filename [arguments]\n", c.Args[0], c.Args[0])
+		return statusError(2)
+	}
+
+	sh := c.sh
+	file := sh.findSource(args[0])
+	src, err := os.ReadFile(sh.abs(file))
+	if err != nil {
+		fmt.Fprintf(c.stdio.Err, "%s: %s\n", args[0], errorReason(err))
+		return statusError(1)
+	}
+
+	// the arguments are the positional parameters while the file runs
+	if len(args) > 1 {
+		saved := sh.positional()
+		sh.setPositional(args[1:])
+		defer sh.setPositional(saved)
+	}
+
+	sh.sourced++
+	sh.lastStatus = 0
+	err = sh.runSource(file, string(src), c.files)
+	sh.sourced--
+	if errors.Is(err, errReturn) {
+		err = nil
+	}
+	if err != nil && !isControlErr(err) {
+		fmt.Fprintln(c.files.stderr, err)
+		return statusError(sh.lastStatus)
+	}
+	if err == nil && sh.lastStatus != 0 {
+		err = statusError(sh.lastStatus)
+	}
+	return err
+}
+
+// prefixWriter starts each line written to w with prefix.
+type prefixWriter struct {
+	w      io.Writer
+	prefix string
+	// midLine is set when the last write did not end a line.
+	midLine bool
+}
+
+func (pw *prefixWriter) Write(p []byte) (int, error) {
+	for rest := p; len(rest) > 0; {
+		line := rest
+		if i := slices.Index(rest, '\n'); i >= 0 {
+			line = rest[:i+1]
+		}
+		rest = rest[len(line):]
+
+		if !pw.midLine {
+			if _, err := io.WriteString(pw.w, pw.prefix); err != nil {
+				return 0, err
+			}
+		}
+		if _, err := pw.w.Write(line); err != nil {
+			return 0, err
+		}
+		pw.midLine = line[len(line)-1] != '\n'
+	}
+	return len(p), nil
+}
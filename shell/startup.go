@@ -0,0 +1,100 @@
+package shell
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+const (
+	// rcFile is run by interactive shells, profileFile by login shells.
+	rcFile      = "~/.myshellrc"
+	profileFile = "~/.myshell_profile"
+)
+
+// RunStartup runs the startup files of the shell. A login shell runs
+// ~/.myshell_profile. An interactive shell that is not a login shell then
+// runs Config.RCFile, ~/.myshellrc by default, unless Config.NoRC is set. In
+// POSIX mode an interactive shell runs the file named by $ENV instead. Files
+// that do not exist are skipped, unless given as RCFile, and the errors in
+// them are reported with their file and line. The error is ErrExit if a file
+// ran exit.
+func (sh *Shell) RunStartup(ctx context.Context, interactive bool) error {
+	sh.interactive = interactive
+	if sh.login {
+		if err := sh.runStartupFile(ctx, sh.homePath(profileFile), false); err != nil {
+			return err
+		}
+	}
+	if !interactive {
+		return nil
+	}
+
+	switch {
+	case sh.opts.Get(OptPosix):
+		env, ok := sh.getVar("ENV")
+		if !ok || env == "" {
+			return nil
+		}
+		file, err := sh.expandWord(NewWordToken(env, env))
+		if err != nil {
+			fmt.Fprintf(sh.stdio.Err, "ENV: %s\n", err)
+			return nil
+		}
+		return sh.runStartupFile(ctx, file, false)
+	case sh.login:
+		// the profile runs the rc file if it wants to
+		return nil
+	case sh.noRC:
+		return nil
+	case sh.rcFile != "":
+		return sh.runStartupFile(ctx, sh.rcFile, true)
+	}
+	return sh.runStartupFile(ctx, sh.homePath(rcFile), false)
+}
+
+// runStartupFile runs file like `source` would. Only exit and the end of ctx
+// are returned, other errors are reported.
+func (sh *Shell) runStartupFile(ctx context.Context, file string, mustExist bool) error {
+	if file == "" {
+		return nil
+	}
+	src, err := os.ReadFile(sh.abs(file))
+	if err != nil {
+		if mustExist || !errors.Is(err, fs.ErrNotExist) {
+			fmt.Fprintf(sh.stdio.Err, "%s: %s\n", file, errorReason(err))
+		}
+		return nil
+	}
+
+	sh.sourced++
+	_, err = sh.eval(ctx, func(files ioFiles) error {
+		return sh.runSource(file, string(src), files)
+	})
+	sh.sourced--
+	switch {
+	case err == nil, errors.Is(err, errReturn):
+		return nil
+	case isControlErr(err), ctx.Err() != nil:
+		return err
+	}
+	fmt.Fprintln(sh.stdio.Err, err)
+	return nil
+}
+
+// homePath puts HOME in place of the ~ of name, it is empty if HOME is not
+// set.
+func (sh *Shell) homePath(name string) string {
+	rest, ok := strings.CutPrefix(name, "~")
+	if !ok {
+		return name
+	}
+	home, ok := sh.getVar("HOME")
+	if !ok || home == "" {
+		return ""
+	}
+	return strings.TrimSuffix(home, "/") + rest
+}
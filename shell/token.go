@@ -0,0 +1,115 @@
+package shell
+
+import "slices"
+
+type TokenType int
+
+const (
+	TokenEOF TokenType = iota + 1
+	TokenWord
+	TokenRedirectOut       // 1>
+	TokenRedirectOutAppend // 1>>
+	TokenRedirectErr       // 2>
+	TokenRedirectErrAppend // 2>>
+	TokenPipeline          // |
+	TokenRedirectIn        // <
+	TokenNewline           // \n
+	TokenSemicolon         // ;
+	TokenAnd               // &&
+	TokenOr                // ||
+	TokenBackground        // &
+	TokenLParen            // (
+	TokenRParen            // )
+	TokenDSemi             // ;;
+	TokenSemiAnd           // ;&
+	TokenDSemiAnd          // ;;&
+)
+
+type Token struct {
+	Type TokenType
+	Val  string
+
+	// Raw is the source text of a word with its quotes and escapes intact,
+	// expansion works on it rather than on Val.
+	Raw string
+	// Line is the line of the input the token starts on, counting from 1.
+	Line int
+
+	// aliases are the aliases whose expansion produced the token, they are
+	// not expanded again in it. checkAlias marks a word that is expanded
+	// even though it is not the first of the command.
+	aliases    []string
+	checkAlias bool
+}
+
+func NewToken(tokenType TokenType, val string) Token {
+	return Token{
+		Type: tokenType,
+		Val:  val,
+		Raw:  val,
+	}
+}
+
+func NewWordToken(val, raw string) Token {
+	return Token{
+		Type: TokenWord,
+		Val:  val,
+		Raw:  raw,
+	}
+}
+
+// reservedWords are the words the parser knows when they start a command,
+// `type` calls them keywords.
+var reservedWords = []string{"!", "[[", "]]", "case", "esac", "function", "in", "{", "}"}
+
+func isReservedWord(w string) bool {
+	return slices.Contains(reservedWords, w)
+}
+
+// IsReserved reports whether t is the unquoted reserved word w.
+func (t Token) IsReserved(w string) bool {
+	return t.Type == TokenWord && t.Raw == w
+}
+
+func (t TokenType) String() string {
+	switch t {
+	case TokenEOF:
+		return "EOF"
+	case TokenWord:
+		return "WORD"
+	case TokenRedirectOut:
+		return "REDIRECT_OUT"
+	case TokenRedirectOutAppend:
+		return "REDIRECT_OUT_APPEND"
+	case TokenRedirectErr:
+		return "REDIRECT_ERR"
+	case TokenRedirectErrAppend:
+		return "REDIRECT_ERRAPPEND"
+	case TokenPipeline:
+		return "PIPELINE"
+	case TokenRedirectIn:
+		return "REDIRECT_IN"
+	case TokenNewline:
+		return "NEWLINE"
+	case TokenSemicolon:
+		return "SEMICOLON"
+	case TokenAnd:
+		return "AND"
+	case TokenOr:
+		return "OR"
+	case TokenBackground:
+		return "BACKGROUND"
+	case TokenLParen:
+		return "LPAREN"
+	case TokenRParen:
+		return "RPAREN"
+	case TokenDSemi:
+		return "DSEMI"
+	case TokenSemiAnd:
+		return "SEMI_AND"
+	case TokenDSemiAnd:
+		return "DSEMI_AND"
+	default:
+		return "UNKNOWN"
+	}
+}
@@ -0,0 +1,312 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// pseudoSignals are the trap conditions that are not signals. EXIT is 0 as
+// in `trap cmd 0`.
+var pseudoSignals = []string{"EXIT", "ERR", "DEBUG", "RETURN"}
+
+// signalNames lists the signals trap knows by name, in signal number order.
+var signalNames = []struct {
+	sig  syscall.Signal
+	name string
+}{
+	{syscall.SIGHUP, "HUP"},
+	{syscall.SIGINT, "INT"},
+	{syscall.SIGQUIT, "QUIT"},
+	{syscall.SIGILL, "ILL"},
+	{syscall.SIGTRAP, "TRAP"},
+	{syscall.SIGABRT, "ABRT"},
+	{syscall.SIGBUS, "BUS"},
+	{syscall.SIGFPE, "FPE"},
+	{syscall.SIGKILL, "KILL"},
+	{syscall.SIGUSR1, "USR1"},
+	{syscall.SIGSEGV, "SEGV"},
+	{syscall.SIGUSR2, "USR2"},
+	{syscall.SIGPIPE, "PIPE"},
+	{syscall.SIGALRM, "ALRM"},
+	{syscall.SIGTERM, "TERM"},
+	{syscall.SIGCHLD, "CHLD"},
+	{syscall.SIGCONT, "CONT"},
+	{syscall.SIGSTOP, "STOP"},
+	{syscall.SIGTSTP, "TSTP"},
+	{syscall.SIGTTIN, "TTIN"},
+	{syscall.SIGTTOU, "TTOU"},
+	{syscall.SIGURG, "URG"},
+	{syscall.SIGXCPU, "XCPU"},
+	{syscall.SIGXFSZ, "XFSZ"},
+	{syscall.SIGVTALRM, "VTALRM"},
+	{syscall.SIGPROF, "PROF"},
+	{syscall.SIGWINCH, "WINCH"},
+	{syscall.SIGIO, "IO"},
+	{syscall.SIGSYS, "SYS"},
+}
+
+// keyboardSignals are caught by an interactive shell even without a trap.
+var keyboardSignals = []os.Signal{syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTSTP}
+
+// parseSignal turns a trap condition given by name, with or without the SIG
+// prefix, or by number into the key used in sh.traps. The signal is 0 for
+// the pseudo signals.
+func parseSignal(spec string) (string, syscall.Signal, bool) {
+	if n, err := strconv.Atoi(spec); err == nil {
+		if n == 0 {
+			return "EXIT", 0, true
+		}
+		for _, s := range signalNames {
+			if int(s.sig) == n {
+				return s.name, s.sig, true
+			}
+		}
+		return "", 0, false
+	}
+
+	name := strings.TrimPrefix(strings.ToUpper(spec), "SIG")
+	for _, p := range pseudoSignals {
+		if name == p {
+			return p, 0, true
+		}
+	}
+	for _, s := range signalNames {
+		if name == s.name {
+			return s.name, s.sig, true
+		}
+	}
+	return "", 0, false
+}
+
+func signalName(sig syscall.Signal) string {
+	for _, s := range signalNames {
+		if s.sig == sig {
+			return s.name
+		}
+	}
+	return ""
+}
+
+// trapOrder returns the conditions that have a trap in the order `trap -p`
+// lists them: EXIT, the signals by number, then the other pseudo signals.
+func (sh *Shell) trapOrder() []string {
+	names := []string{"EXIT"}
+	for _, s := range signalNames {
+		names = append(names, s.name)
+	}
+	names = append(names, pseudoSignals[1:]...)
+
+	var res []string
+	for _, name := range names {
+		if _, ok := sh.traps[name]; ok {
+			res = append(res, name)
+		}
+	}
+	return res
+}
+
+// trapLabel is how `trap -p` names a condition.
+func trapLabel(name string) string {
+	for _, p := range pseudoSignals {
+		if name == p {
+			return name
+		}
+	}
+	return "SIG" + name
+}
+
+// setTrap installs action for the condition. A nil action restores the
+// default, an empty one ignores the signal.
+func (sh *Shell) setTrap(name string, sig syscall.Signal, action *string) {
+	if action == nil {
+		delete(sh.traps, name)
+	} else {
+		sh.traps[name] = *action
+	}
+
+	// signals are delivered to the process, only the shell that owns the
+	// channel changes their disposition
+	if sig == 0 || sh.signals == nil {
+		return
+	}
+	switch {
+	case action == nil && sh.jobControl && isKeyboardSignal(sig):
+		signal.Notify(sh.signals, sig)
+	case action == nil:
+		signal.Reset(sig)
+	case *action == "":
+		signal.Ignore(sig)
+	default:
+		signal.Notify(sh.signals, sig)
+	}
+}
+
+func isKeyboardSignal(sig os.Signal) bool {
+	for _, s := range keyboardSignals {
+		if s == sig {
+			return true
+		}
+	}
+	return false
+}
+
+// runTrap runs the action for the condition if one is set. Traps do not
+// nest and leave $? as it was, unless the action exits the shell.
+func (sh *Shell) runTrap(name string, files ioFiles) error {
+	action, ok := sh.traps[name]
+	if !ok || action == "" || sh.inTrap {
+		return nil
+	}
+
+	prog, err := sh.parse(action)
+	if err != nil {
+		fmt.Fprintf(files.stderr, "trap: %s\n", err)
+		return nil
+	}
+
+	status := sh.lastStatus
+	sh.inTrap = true
+	err = sh.runList(prog, files)
+	sh.inTrap = false
+	if errors.Is(err, ErrExit) {
+		return err
+	}
+	sh.lastStatus = status
+	return nil
+}
+
+// runExitTrap runs the EXIT trap once, when the shell or subshell ends.
+// The exit status stays unless the action calls exit.
+func (sh *Shell) runExitTrap(files ioFiles) {
+	status := sh.lastStatus
+	err := sh.runTrap("EXIT", files)
+	delete(sh.traps, "EXIT")
+	if !errors.Is(err, ErrExit) {
+		sh.lastStatus = status
+	}
+}
+
+// runPendingTraps runs the actions of the signals that arrived since it was
+// last called. It is called between commands.
+func (sh *Shell) runPendingTraps(files ioFiles) error {
+	if sh.signals == nil {
+		return nil
+	}
+	for {
+		select {
+		case s := <-sh.signals:
+			sig, ok := s.(syscall.Signal)
+			if !ok {
+				continue
+			}
+			if err := sh.runTrap(signalName(sig), files); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+// runErrTrap runs the ERR trap after a command failed. Like DEBUG it is not
+// inherited by functions.
+func (sh *Shell) runErrTrap(files ioFiles) error {
+	if len(sh.frames) > 0 {
+		return nil
+	}
+	return sh.runTrap("ERR", files)
+}
+
+func (c *Command) execTrap() error {
+	var (
+		list  bool
+		print bool
+	)
+	args := c.Args[1:]
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") && args[0] != "-" {
+		arg := args[0]
+		args = args[1:]
+		if arg == "--" {
+			break
+		}
+		switch arg {
+		case "-l":
+			list = true
+		case "-p":
+			print = true
+		default:
+			fmt.Fprintf(c.stdio.Err, "trap: %s: invalid option\n", arg)
+			fmt.Fprintln(c.stdio.Err, "trap: usage: trap [-lp] [[arg] signal_spec ...]")
+			return statusError(2)
+		}
+	}
+
+	if list {
+		for i, s := range signalNames {
+			sep := "\t"
+			if (i+1)%5 == 0 || i == len(signalNames)-1 {
+				sep = "\n"
+			}
+			fmt.Fprintf(c.stdio.Out, "%2d) SIG%s%s", int(s.sig), s.name, sep)
+		}
+		return nil
+	}
+
+	if print || len(args) == 0 {
+		names := args
+		if len(names) == 0 {
+			names = c.sh.trapOrder()
+		}
+		status := 0
+		for _, spec := range names {
+			name, _, ok := parseSignal(spec)
+			if !ok {
+				fmt.Fprintf(c.stdio.Err, "trap: %s: invalid signal specification\n", spec)
+				status = 1
+				continue
+			}
+			if action, ok := c.sh.traps[name]; ok {
+				fmt.Fprintf(c.stdio.Out, "trap -- %s %s\n", shellQuote(action), trapLabel(name))
+			}
+		}
+		if status != 0 {
+			return statusError(status)
+		}
+		return nil
+	}
+
+	// a lone condition, or `-` as the action, restores the default
+	var action *string
+	if _, _, ok := parseSignal(args[0]); ok && len(args) == 1 {
+		action = nil
+	} else {
+		if args[0] != "-" {
+			action = &args[0]
+		}
+		args = args[1:]
+		if len(args) == 0 {
+			fmt.Fprintln(c.stdio.Err, "trap: usage: trap [-lp] [[arg] signal_spec ...]")
+			return statusError(2)
+		}
+	}
+
+	status := 0
+	for _, spec := range args {
+		name, sig, ok := parseSignal(spec)
+		if !ok {
+			fmt.Fprintf(c.stdio.Err, "trap: %s: invalid signal specification\n", spec)
+			status = 1
+			continue
+		}
+		c.sh.setTrap(name, sig, action)
+	}
+	if status != 0 {
+		return statusError(status)
+	}
+	return nil
+}
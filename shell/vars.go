@@ -0,0 +1,110 @@
+package shell
+
+import (
+	"sort"
+	"strings"
+)
+
+// Variable is a shell variable. Indexed arrays keep their elements in Array,
+// a plain reference to them reads element 0.
+type Variable struct {
+	Value    string
+	Array    []string
+	Exported bool
+}
+
+func (sh *Shell) initVars(env []string) {
+	sh.vars = make(map[string]*Variable)
+	for _, kv := range env {
+		name, value, ok := strings.Cut(kv, "=")
+		if !ok {
+			continue
+		}
+		sh.vars[name] = &Variable{Value: value, Exported: true}
+	}
+	if _, ok := sh.vars["IFS"]; !ok {
+		sh.vars["IFS"] = &Variable{Value: " \t\n"}
+	}
+}
+
+func (sh *Shell) getVar(name string) (string, bool) {
+	v, ok := sh.vars[name]
+	if !ok {
+		return "", false
+	}
+	if v.Array != nil {
+		if len(v.Array) == 0 {
+			return "", false
+		}
+		return v.Array[0], true
+	}
+	return v.Value, true
+}
+
+// getArray returns the elements of name, a scalar reads as a one element
+// array.
+func (sh *Shell) getArray(name string) []string {
+	v, ok := sh.vars[name]
+	if !ok {
+		return nil
+	}
+	if v.Array != nil {
+		return v.Array
+	}
+	return []string{v.Value}
+}
+
+func (sh *Shell) setArray(name string, values []string) {
+	if values == nil {
+		values = []string{}
+	}
+	v, ok := sh.vars[name]
+	if !ok {
+		sh.vars[name] = &Variable{Array: values}
+		return
+	}
+	v.Array = values
+	v.Value = ""
+}
+
+func (sh *Shell) setVar(name, value string) {
+	if name == "PATH" {
+		clear(sh.hash)
+	}
+	v, ok := sh.vars[name]
+	if !ok {
+		sh.vars[name] = &Variable{Value: value}
+		return
+	}
+	if v.Array != nil {
+		v.Array = append([]string{value}, v.Array[min(1, len(v.Array)):]...)
+		return
+	}
+	v.Value = value
+}
+
+func (sh *Shell) unsetVar(name string) {
+	delete(sh.vars, name)
+}
+
+// environ returns the exported variables in os.Environ form, overlaid with
+// the extra NAME=value pairs.
+func (sh *Shell) environ(extra ...string) []string {
+	env := make(map[string]string)
+	for name, v := range sh.vars {
+		if v.Exported {
+			env[name] = v.Value
+		}
+	}
+	for _, kv := range extra {
+		name, value, _ := strings.Cut(kv, "=")
+		env[name] = value
+	}
+
+	res := make([]string, 0, len(env))
+	for name, value := range env {
+		res = append(res, name+"="+value)
+	}
+	sort.Strings(res)
+	return res
+}
@@ -0,0 +1,271 @@
+package shell
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The z database keeps one line per directory, `path|rank|time`, in the
+// format of the z shell script so an existing ~/.z keeps working.
+
+// zMaxRank is the total rank above which all the ranks age.
+const zMaxRank = 9000
+
+type zEntry struct {
+	path string
+	rank float64
+	time int64
+}
+
+// zDataPath returns the database file, $_Z_DATA or ~/.z, or "" if neither
+// is set.
+func zDataPath(getenv func(string) (string, bool)) string {
+	if p, ok := getenv("_Z_DATA"); ok && p != "" {
+		return p
+	}
+	if home, ok := getenv("HOME"); ok && home != "" {
+		return filepath.Join(home, ".z")
+	}
+	return ""
+}
+
+func readZ(path string) ([]zEntry, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []zEntry
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Split(sc.Text(), "|")
+		if len(fields) != 3 {
+			continue
+		}
+		rank, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			continue
+		}
+		t, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		entries = append(entries, zEntry{path: fields[0], rank: rank, time: t})
+	}
+	return entries, sc.Err()
+}
+
+// writeZ replaces the database through a temporary file, so that shells
+// writing at the same time never leave a partial one.
+func writeZ(path string, entries []zEntry) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s|%s|%d\n", e.path, strconv.FormatFloat(e.rank, 'g', -1, 64), e.time)
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// addVisit counts a visit to dir at now. Once the ranks add up to more
+// than zMaxRank they all age, and the entries that drop below one go.
+func addVisit(entries []zEntry, dir string, now int64) []zEntry {
+	found := false
+	total := 0.0
+	for i := range entries {
+		if entries[i].path == dir {
+			entries[i].rank++
+			entries[i].time = now
+			found = true
+		}
+		total += entries[i].rank
+	}
+	if !found {
+		entries = append(entries, zEntry{path: dir, rank: 1, time: now})
+		total++
+	}
+
+	if total <= zMaxRank {
+		return entries
+	}
+	kept := entries[:0]
+	for _, e := range entries {
+		e.rank *= 0.99
+		if e.rank >= 1 {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
+
+// frecency weighs the rank of e by how recently it was visited.
+func (e zEntry) frecency(now int64) float64 {
+	switch dt := now - e.time; {
+	case dt < 3600:
+		return e.rank * 4
+	case dt < 86400:
+		return e.rank * 2
+	case dt < 604800:
+		return e.rank / 2
+	}
+	return e.rank / 4
+}
+
+// zMatches returns the entries whose path holds the patterns in order,
+// best first. The match ignores case only if no path matches with it.
+func zMatches(entries []zEntry, patterns []string, now int64) []zEntry {
+	var res []zEntry
+	for _, fold := range []bool{false, true} {
+		for _, e := range entries {
+			if zMatch(e.path, patterns, fold) {
+				res = append(res, e)
+			}
+		}
+		if len(res) > 0 {
+			break
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].frecency(now) > res[j].frecency(now)
+	})
+	return res
+}
+
+func zMatch(path string, patterns []string, fold bool) bool {
+	if fold {
+		path = strings.ToLower(path)
+	}
+	for _, p := range patterns {
+		if fold {
+			p = strings.ToLower(p)
+		}
+		i := strings.Index(path, p)
+		if i < 0 {
+			return false
+		}
+		path = path[i+len(p):]
+	}
+	return true
+}
+
+// recordDir adds a visit to dir to the z database. The home directory is
+// not recorded, and failures are ignored since they should not fail cd.
+func (sh *Shell) recordDir(dir string) {
+	if home, _ := sh.getVar("HOME"); dir == home {
+		return
+	}
+	path := zDataPath(sh.getVar)
+	if path == "" {
+		return
+	}
+	entries, err := readZ(path)
+	if err != nil {
+		return
+	}
+	_ = writeZ(path, addVisit(entries, dir, time.Now().Unix()))
+}
+
+// zCandidates returns the directories of the database matching patterns,
+// best first, leaving out those that no longer exist.
+func zCandidates(path string, patterns []string) ([]zEntry, error) {
+	entries, err := readZ(path)
+	if err != nil {
+		return nil, err
+	}
+	var res []zEntry
+	for _, e := range zMatches(entries, patterns, time.Now().Unix()) {
+		if checkDir(e.path) == nil {
+			res = append(res, e)
+		}
+	}
+	return res, nil
+}
+
+func (c *Command) execZ() error {
+	list := false
+	args := c.Args[1:]
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		arg := args[0]
+		args = args[1:]
+		if arg == "--" {
+			break
+		}
+		if arg != "-l" {
+			fmt.Fprintf(c.stdio.Err, "z: %s: invalid option\n", arg)
+			fmt.Fprintln(c.stdio.Err, "z: usage: z [-l] [pattern ...]")
+			return statusError(2)
+		}
+		list = true
+	}
+
+	path := zDataPath(c.sh.getVar)
+	if path == "" {
+		fmt.Fprintln(c.stdio.Err, "z: neither _Z_DATA nor HOME is set")
+		return statusError(1)
+	}
+	matches, err := zCandidates(path, args)
+	if err != nil {
+		fmt.Fprintf(c.stdio.Err, "z: %s: %s\n", path, errorReason(err))
+		return statusError(1)
+	}
+
+	if list || len(args) == 0 {
+		// the best match comes last, next to the prompt
+		now := time.Now().Unix()
+		for i := len(matches) - 1; i >= 0; i-- {
+			fmt.Fprintf(c.stdio.Out, "%-10.2f %s\n", matches[i].frecency(now), matches[i].path)
+		}
+		if len(matches) == 0 {
+			return statusError(1)
+		}
+		return nil
+	}
+
+	if len(matches) == 0 {
+		fmt.Fprintf(c.stdio.Err, "z: %s: no match\n", strings.Join(args, " "))
+		return statusError(1)
+	}
+	return c.changeDir(matches[0].path, false)
+}
+
+// completeZ offers the directories matching the words typed so far, from
+// the database the shell's variables name.
+func completeZ(getVar func(string) (string, bool), args []string) []string {
+	if len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		args = args[1:]
+	}
+	path := zDataPath(getVar)
+	if path == "" || len(args) == 0 {
+		return nil
+	}
+	matches, err := zCandidates(path, args)
+	if err != nil {
+		return nil
+	}
+	res := make([]string, 0, len(matches))
+	for _, e := range matches {
+		res = append(res, e.path)
+	}
+	return res
+}